@@ -0,0 +1,106 @@
+// Command apikey mints an API key for the management API, which is how the
+// first admin key is created. The key is printed once and never stored.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/ffss92/webhookd/internal/auth"
+	"github.com/ffss92/webhookd/internal/config"
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/postgres"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	_ = godotenv.Load()
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+var (
+	name        string
+	scopes      string
+	subscriber  string
+	application string
+)
+
+func run() error {
+	flag.StringVar(&name, "name", "admin", "Name of the API key")
+	flag.StringVar(&scopes, "scopes", auth.ScopeAdmin, "Comma separated scopes granted to the API key")
+	flag.StringVar(&subscriber, "subscriber", "", "Restricts the API key to the subscriber with this id")
+	flag.StringVar(&application, "application", database.DefaultApplicationID.String(), "Id of the application the API key manages")
+	flag.Parse()
+
+	appID, err := uuid.Parse(application)
+	if err != nil {
+		return fmt.Errorf("invalid application id: %w", err)
+	}
+
+	granted := strings.Split(scopes, ",")
+	for _, scope := range granted {
+		if !auth.ValidScope(scope) {
+			return fmt.Errorf("invalid scope %q, must be one of %s", scope, strings.Join(auth.Scopes, ", "))
+		}
+	}
+
+	var subID *uuid.UUID
+	if subscriber != "" {
+		if slices.Contains(granted, auth.ScopeAdmin) {
+			return fmt.Errorf("subscriber keys can't be granted the %s scope", auth.ScopeAdmin)
+		}
+		id, err := uuid.Parse(subscriber)
+		if err != nil {
+			return fmt.Errorf("invalid subscriber id: %w", err)
+		}
+		subID = &id
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.NewFromEnv()
+	if err != nil {
+		return err
+	}
+
+	pool, err := postgres.New(ctx, cfg.DBConn())
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	store := database.New(pool, database.WithApplication(appID))
+	if _, err := store.GetApplication(ctx, appID); err != nil {
+		return fmt.Errorf("failed to get application: %w", err)
+	}
+	if subID != nil {
+		if _, err := store.GetSubscriber(ctx, *subID); err != nil {
+			return fmt.Errorf("failed to get subscriber: %w", err)
+		}
+	}
+
+	token := auth.NewKey()
+	err = store.SaveAPIKey(ctx, &database.APIKey{
+		Name:         name,
+		KeyHash:      auth.HashKey(token),
+		Scopes:       granted,
+		SubscriberID: subID,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(token)
+	return nil
+}
@@ -0,0 +1,84 @@
+// Command application creates an application, which isolates a set of
+// subscribers and the API keys allowed to manage them. Its id is printed so
+// the first admin key can be minted with "apikey -application".
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/config"
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/postgres"
+	"github.com/ffss92/webhookd/internal/retry"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	_ = godotenv.Load()
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+var (
+	name          string
+	retrySchedule string
+)
+
+func run() error {
+	flag.StringVar(&name, "name", "", "Name of the application")
+	flag.StringVar(&retrySchedule, "retry-schedule", "", "Comma separated retry delays, such as 0s,1m,1h. Uses RETRY_SCHEDULE when empty")
+	flag.Parse()
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("application name must be provided")
+	}
+
+	var schedule []time.Duration
+	if retrySchedule != "" {
+		for value := range strings.SplitSeq(retrySchedule, ",") {
+			delay, err := time.ParseDuration(strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("invalid retry delay %q", value)
+			}
+			schedule = append(schedule, delay)
+		}
+		if err := retry.CheckSchedule(schedule); err != nil {
+			return fmt.Errorf("retry schedule %w", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.NewFromEnv()
+	if err != nil {
+		return err
+	}
+
+	pool, err := postgres.New(ctx, cfg.DBConn())
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	app := &database.Application{
+		Name:          name,
+		RetrySchedule: schedule,
+	}
+	if err := database.New(pool).SaveApplication(ctx, app); err != nil {
+		return err
+	}
+
+	fmt.Println(app.ID)
+	return nil
+}
@@ -0,0 +1,68 @@
+// Command reencrypt encrypts endpoint secrets with the current key, after
+// SECRET_KEY_VERSION is changed or encryption is enabled for existing rows.
+// Older key versions must remain in SECRET_KEYS until it completes.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ffss92/webhookd/internal/config"
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/postgres"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	_ = godotenv.Load()
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+var (
+	batchSize int
+)
+
+func run() error {
+	flag.IntVar(&batchSize, "batch", 100, "Endpoints updated per transaction")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.NewFromEnv()
+	if err != nil {
+		return err
+	}
+	kr, err := cfg.Keyring()
+	if err != nil {
+		return err
+	}
+	if kr == nil {
+		return errors.New("SECRET_KEYS must be set to encrypt endpoint secrets")
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	pool, err := postgres.New(ctx, cfg.DBConn())
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	store := database.New(pool, database.WithKeyring(kr))
+	updated, err := store.ReencryptEndpointSecrets(ctx, batchSize)
+	logger.Info(
+		"re-encrypted endpoint secrets",
+		slog.Int("updated", updated),
+		slog.String("key_version", cfg.SecretKeyVersion),
+	)
+	return err
+}
@@ -2,14 +2,20 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"log"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/ffss92/webhookd/internal/api"
 	"github.com/ffss92/webhookd/internal/config"
+	"github.com/ffss92/webhookd/internal/delivery"
 	"github.com/ffss92/webhookd/internal/postgres"
 	"github.com/joho/godotenv"
 )
@@ -29,7 +35,8 @@ func run() error {
 	flag.BoolVar(&devMode, "dev", false, "Sets the application in dev mode")
 	flag.Parse()
 
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	cfg, err := config.NewFromEnv()
 	if err != nil {
@@ -54,12 +61,54 @@ func run() error {
 		return err
 	}
 
+	var onEvent delivery.EventHandler
+	if cfg.EventsWebhookURL != "" {
+		onEvent = delivery.NewWebhookEventHandler(cfg.EventsWebhookURL, cfg.EventsWebhookSecret, cfg.DeliveryTimeout, logger)
+	}
+
+	dispatcher, err := delivery.NewDispatcher(delivery.DispatcherConfig{
+		Config:  cfg,
+		Pool:    pool,
+		Logger:  logger,
+		OnEvent: onEvent,
+	})
+	if err != nil {
+		return err
+	}
+
 	srv := &http.Server{
 		Addr:     cfg.Addr(),
 		Handler:  apisrv.Routes(),
 		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
 	}
 
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		logger.Info("starting dispatcher")
+		if err := dispatcher.Run(ctx); err != nil {
+			logger.Error("dispatcher stopped", slog.String("err", err.Error()))
+		}
+	}()
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		shutdownErr <- srv.Shutdown(ctx)
+	}()
+
 	logger.Info("starting server", slog.String("addr", srv.Addr), slog.Bool("dev", devMode))
-	return srv.ListenAndServe()
+	err = srv.ListenAndServe()
+	if !errors.Is(err, http.ErrServerClosed) {
+		stop()
+		wg.Wait()
+		return err
+	}
+
+	err = <-shutdownErr
+	wg.Wait()
+	return err
 }
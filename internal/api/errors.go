@@ -28,12 +28,37 @@ func (s *Server) badRequest(w http.ResponseWriter, r *http.Request, _ error) {
 	})
 }
 
+func (s *Server) contentTooLarge(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, r, http.StatusRequestEntityTooLarge, ErrorResponse{
+		Message: "Request body is too large",
+	})
+}
+
+func (s *Server) unauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	s.writeJSON(w, r, http.StatusUnauthorized, ErrorResponse{
+		Message: "Missing or invalid API key",
+	})
+}
+
+func (s *Server) forbidden(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, r, http.StatusForbidden, ErrorResponse{
+		Message: "API key is not allowed to perform this action",
+	})
+}
+
 func (s *Server) notFound(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, r, http.StatusNotFound, ErrorResponse{
 		Message: "Resource not found",
 	})
 }
 
+func (s *Server) conflict(w http.ResponseWriter, r *http.Request, message string) {
+	s.writeJSON(w, r, http.StatusConflict, ErrorResponse{
+		Message: message,
+	})
+}
+
 func (s *Server) validationError(w http.ResponseWriter, r *http.Request, errors map[string]string) {
 	s.writeJSON(w, r, http.StatusUnprocessableEntity, ErrorResponse{
 		Message: "Validation failed",
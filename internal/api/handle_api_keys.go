@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/auth"
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/validator"
+	"github.com/google/uuid"
+)
+
+type APIKey struct {
+	ID            uuid.UUID  `json:"id"`
+	ApplicationID uuid.UUID  `json:"application_id"`
+	Name          string     `json:"name"`
+	Scopes        []string   `json:"scopes"`
+	SubscriberID  *uuid.UUID `json:"subscriber_id"`
+	LastUsedAt    *time.Time `json:"last_used_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+func mapAPIKey(record *database.APIKey) *APIKey {
+	return &APIKey{
+		ID:            record.ID,
+		ApplicationID: record.ApplicationID,
+		Name:          record.Name,
+		Scopes:        record.Scopes,
+		SubscriberID:  record.SubscriberID,
+		LastUsedAt:    record.LastUsedAt,
+		CreatedAt:     record.CreatedAt,
+	}
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// Restricts the key to the resources of a single subscriber.
+	SubscriberID *uuid.UUID `json:"subscriber_id"`
+
+	validator.Validator `json:"-"`
+}
+
+// The key is only ever returned on creation.
+type CreateAPIKeyResponse struct {
+	*APIKey
+	Key string `json:"key"`
+}
+
+func checkScopes(v *validator.Validator, scopes []string) {
+	v.Check(len(scopes) > 0, "scopes", "Must have at least one scope")
+	for _, scope := range scopes {
+		v.Check(auth.ValidScope(scope), "scopes", "Must only contain valid scopes")
+	}
+}
+
+func (s *Server) handleAPIKeyCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input CreateAPIKeyRequest
+		err := json.NewDecoder(r.Body).Decode(&input)
+		if err != nil {
+			s.badRequest(w, r, err)
+			return
+		}
+
+		input.Name = strings.TrimSpace(input.Name)
+		input.Check(validator.NotBlank(input.Name), "name", "Must be provided")
+		input.Check(validator.MaxLength(input.Name, 255), "name", "Must have at most 255 characters")
+		checkScopes(&input.Validator, input.Scopes)
+		if input.SubscriberID != nil {
+			input.Check(!slices.Contains(input.Scopes, auth.ScopeAdmin), "scopes", "Must not include admin for a subscriber key")
+		}
+		if !input.IsValid() {
+			s.validationError(w, r, input.FieldErrors)
+			return
+		}
+
+		if input.SubscriberID != nil {
+			_, err := s.appStore(r.Context()).GetSubscriber(r.Context(), *input.SubscriberID)
+			if err != nil {
+				switch {
+				case errors.Is(err, database.ErrNotFound):
+					input.SetFieldError("subscriber_id", "Invalid subscriber_id value")
+					s.validationError(w, r, input.FieldErrors)
+				default:
+					s.serverError(w, r, err)
+				}
+				return
+			}
+		}
+
+		token := auth.NewKey()
+		key := &database.APIKey{
+			Name:         input.Name,
+			KeyHash:      auth.HashKey(token),
+			Scopes:       input.Scopes,
+			SubscriberID: input.SubscriberID,
+		}
+		err = s.appStore(r.Context()).SaveAPIKey(r.Context(), key)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusCreated, CreateAPIKeyResponse{
+			APIKey: mapAPIKey(key),
+			Key:    token,
+		})
+	}
+}
+
+func (s *Server) handleAPIKeyDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyID, err := uuidParam(r, "keyID")
+		if err != nil {
+			s.notFound(w, r)
+			return
+		}
+
+		err = s.appStore(r.Context()).DeleteAPIKey(r.Context(), keyID)
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				s.notFound(w, r)
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
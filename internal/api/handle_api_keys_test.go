@@ -0,0 +1,357 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ffss92/webhookd/internal/auth"
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	sub := &database.Subscriber{
+		Name: "test",
+	}
+	err := api.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name   string
+		client func(t *testing.T) *http.Client
+		status int
+	}{
+		{
+			name: "missing key",
+			client: func(t *testing.T) *http.Client {
+				return srv.Client()
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown key",
+			client: func(t *testing.T) *http.Client {
+				client := srv.Client()
+				client.Transport = bearerTransport{token: auth.NewKey(), base: client.Transport}
+				return client
+			},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name: "missing scope",
+			client: func(t *testing.T) *http.Client {
+				return authClient(t, srv, api.store, auth.ScopeEndpointsRead)
+			},
+			status: http.StatusForbidden,
+		},
+		{
+			name: "granted scope",
+			client: func(t *testing.T) *http.Client {
+				return authClient(t, srv, api.store, auth.ScopeSubscribersRead)
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "admin",
+			client: func(t *testing.T) *http.Client {
+				return authClient(t, srv, api.store, auth.ScopeAdmin)
+			},
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			url := fmt.Sprintf("%s/api/v1/subscribers/%s", srv.URL, sub.ID)
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := tt.client(t).Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHandleAPIKeyCreate(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	testCases := []struct {
+		name   string
+		req    *CreateAPIKeyRequest
+		scopes []string
+		status int
+	}{
+		{
+			name: "valid request",
+			req: &CreateAPIKeyRequest{
+				Name:   "test",
+				Scopes: []string{auth.ScopeEndpointsRead},
+			},
+			scopes: []string{auth.ScopeAdmin},
+			status: http.StatusCreated,
+		},
+		{
+			name: "invalid scope",
+			req: &CreateAPIKeyRequest{
+				Name:   "test",
+				Scopes: []string{"endpoints:delete"},
+			},
+			scopes: []string{auth.ScopeAdmin},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "missing name",
+			req: &CreateAPIKeyRequest{
+				Scopes: []string{auth.ScopeEndpointsRead},
+			},
+			scopes: []string{auth.ScopeAdmin},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "admin subscriber key",
+			req: &CreateAPIKeyRequest{
+				Name:         "test",
+				Scopes:       []string{auth.ScopeAdmin},
+				SubscriberID: &uuid.Nil,
+			},
+			scopes: []string{auth.ScopeAdmin},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "non existing subscriber",
+			req: &CreateAPIKeyRequest{
+				Name:         "test",
+				Scopes:       []string{auth.ScopeEndpointsRead},
+				SubscriberID: &uuid.Nil,
+			},
+			scopes: []string{auth.ScopeAdmin},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "not admin",
+			req: &CreateAPIKeyRequest{
+				Name:   "test",
+				Scopes: []string{auth.ScopeEndpointsRead},
+			},
+			scopes: []string{auth.ScopeEndpointsWrite},
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/api-keys", bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := authClient(t, srv, api.store, tt.scopes...)
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+
+			if res.StatusCode == http.StatusCreated {
+				var got CreateAPIKeyResponse
+				err := json.NewDecoder(res.Body).Decode(&got)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				key, err := api.store.GetAPIKeyByHash(t.Context(), auth.HashKey(got.Key))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if key.ID != got.ID {
+					t.Fatalf("expected key %s but got %s", got.ID, key.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscriberKey(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	subs := make([]*database.Subscriber, 2)
+	endpoints := make([]*database.Endpoint, 2)
+	msgs := make([]*database.Message, 2)
+	for i := range subs {
+		subs[i] = &database.Subscriber{Name: fmt.Sprintf("test-%d", i)}
+		err := api.store.SaveSubscriber(t.Context(), subs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		endpoints[i] = &database.Endpoint{
+			Label:        "test",
+			URL:          "https://test.com/webhooks",
+			SubscriberID: subs[i].ID,
+		}
+		err = api.store.SaveEndpoint(t.Context(), endpoints[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs[i] = &database.Message{
+			Type:         "test.created",
+			Data:         json.RawMessage(`{}`),
+			SubscriberID: subs[i].ID,
+		}
+		err = api.store.SaveMessage(t.Context(), msgs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	createEndpoint := func(subID string) string {
+		return fmt.Sprintf(`{"label": "test", "url": "https://test.com", "subscriber_id": %q}`, subID)
+	}
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{
+			name:   "own subscriber",
+			method: http.MethodGet,
+			path:   "/api/v1/subscribers/" + subs[0].ID.String(),
+			status: http.StatusOK,
+		},
+		{
+			name:   "other subscriber",
+			method: http.MethodGet,
+			path:   "/api/v1/subscribers/" + subs[1].ID.String(),
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "own endpoint",
+			method: http.MethodGet,
+			path:   "/api/v1/endpoints/" + endpoints[0].ID.String(),
+			status: http.StatusOK,
+		},
+		{
+			name:   "other endpoint",
+			method: http.MethodGet,
+			path:   "/api/v1/endpoints/" + endpoints[1].ID.String(),
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "delete other endpoint",
+			method: http.MethodDelete,
+			path:   "/api/v1/endpoints/" + endpoints[1].ID.String(),
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "create own endpoint",
+			method: http.MethodPost,
+			path:   "/api/v1/endpoints",
+			body:   createEndpoint(subs[0].ID.String()),
+			status: http.StatusCreated,
+		},
+		{
+			name:   "create other endpoint",
+			method: http.MethodPost,
+			path:   "/api/v1/endpoints",
+			body:   createEndpoint(subs[1].ID.String()),
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "other message attempts",
+			method: http.MethodGet,
+			path:   fmt.Sprintf("/api/v1/messages/%s/attempts", msgs[1].ID),
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "create subscriber",
+			method: http.MethodPost,
+			path:   "/api/v1/subscribers",
+			body:   `{"name": "test"}`,
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, bytes.NewReader([]byte(tt.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := keyClient(t, srv, api.store, &database.APIKey{
+				Scopes: []string{
+					auth.ScopeSubscribersRead,
+					auth.ScopeSubscribersWrite,
+					auth.ScopeEndpointsRead,
+					auth.ScopeEndpointsWrite,
+					auth.ScopeAttemptsRead,
+				},
+				SubscriberID: &subs[0].ID,
+			})
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+		})
+	}
+}
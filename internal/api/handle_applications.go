@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/validator"
+	"github.com/google/uuid"
+)
+
+type Application struct {
+	ID            uuid.UUID `json:"id"`
+	Name          string    `json:"name"`
+	RetrySchedule []int64   `json:"retry_schedule"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+func mapApplication(record *database.Application) *Application {
+	return &Application{
+		ID:            record.ID,
+		Name:          record.Name,
+		RetrySchedule: mapRetrySchedule(record.RetrySchedule),
+		CreatedAt:     record.CreatedAt,
+		UpdatedAt:     record.UpdatedAt,
+	}
+}
+
+// Returns the application of the authenticated API key.
+func (s *Server) handleApplicationDetail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		app, err := s.appStore(r.Context()).GetApplication(r.Context(), getAPIKey(r.Context()).ApplicationID)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusOK, mapApplication(app))
+	}
+}
+
+// Fields follow JSON merge patch semantics, a null retry schedule falls back
+// to the default schedule.
+type UpdateApplicationRequest struct {
+	Name          Optional[string]  `json:"name"`
+	RetrySchedule Optional[[]int64] `json:"retry_schedule"`
+
+	validator.Validator `json:"-"`
+}
+
+func (s *Server) handleApplicationUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input UpdateApplicationRequest
+		err := json.NewDecoder(r.Body).Decode(&input)
+		if err != nil {
+			s.badRequest(w, r, err)
+			return
+		}
+
+		input.Name.Value = strings.TrimSpace(input.Name.Value)
+		input.Check(!input.Name.Null, "name", "Must not be null")
+		if input.Name.Set {
+			input.Check(validator.NotBlank(input.Name.Value), "name", "Must be provided")
+			input.Check(validator.MaxLength(input.Name.Value, 255), "name", "Must have at most 255 characters")
+		}
+		checkRetrySchedule(&input.Validator, input.RetrySchedule.Value)
+		if !input.IsValid() {
+			s.validationError(w, r, input.FieldErrors)
+			return
+		}
+
+		store := s.appStore(r.Context())
+		app, err := store.GetApplication(r.Context(), getAPIKey(r.Context()).ApplicationID)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+
+		if input.Name.Set {
+			app.Name = input.Name.Value
+		}
+		if input.RetrySchedule.Set {
+			app.RetrySchedule = parseRetrySchedule(input.RetrySchedule.Value)
+		}
+
+		err = store.UpdateApplication(r.Context(), app)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusOK, mapApplication(app))
+	}
+}
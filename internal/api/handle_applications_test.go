@@ -0,0 +1,223 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ffss92/webhookd/internal/auth"
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/webhook"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHandleApplicationUpdate(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+		want   *Application
+	}{
+		{
+			name:   "rename",
+			body:   `{"name": "renamed"}`,
+			status: http.StatusOK,
+			want:   &Application{Name: "renamed", RetrySchedule: []int64{0, 60}},
+		},
+		{
+			name:   "retry schedule",
+			body:   `{"retry_schedule": [0, 5, 300]}`,
+			status: http.StatusOK,
+			want:   &Application{Name: "test", RetrySchedule: []int64{0, 5, 300}},
+		},
+		{
+			name:   "reset retry schedule",
+			body:   `{"retry_schedule": null}`,
+			status: http.StatusOK,
+			want:   &Application{Name: "test"},
+		},
+		{
+			name:   "null name",
+			body:   `{"name": null}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "negative delay",
+			body:   `{"retry_schedule": [-1]}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "delayed first attempt",
+			body:   `{"retry_schedule": [60]}`,
+			status: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &database.Application{Name: "test", RetrySchedule: parseRetrySchedule([]int64{0, 60})}
+			err := api.store.SaveApplication(t.Context(), app)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := keyClient(t, srv, api.store, &database.APIKey{
+				ApplicationID: app.ID,
+				Scopes:        []string{auth.ScopeAdmin},
+			})
+
+			req, err := http.NewRequest(http.MethodPatch, srv.URL+"/api/v1/application", bytes.NewReader([]byte(tt.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+
+			if res.StatusCode == http.StatusOK {
+				var got Application
+				err := json.NewDecoder(res.Body).Decode(&got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tt.want.ID = app.ID
+				tt.want.CreatedAt = got.CreatedAt
+				tt.want.UpdatedAt = got.UpdatedAt
+				if diff := cmp.Diff(tt.want, &got); diff != "" {
+					t.Fatalf("mismatch (-want, +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestApplicationIsolation(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	app := &database.Application{Name: "other"}
+	err := api.store.SaveApplication(t.Context(), app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := &database.Subscriber{Name: "test"}
+	err = api.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := &database.Endpoint{
+		Label:        "test",
+		URL:          "https://example.com",
+		Secret:       webhook.NewSecret(),
+		SubscriberID: sub.ID,
+	}
+	err = api.store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	owner := authClient(t, srv, api.store, auth.ScopeAdmin)
+	other := keyClient(t, srv, api.store, &database.APIKey{
+		ApplicationID: app.ID,
+		Scopes:        []string{auth.ScopeAdmin},
+	})
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{
+			name:   "subscriber detail",
+			method: http.MethodGet,
+			path:   fmt.Sprintf("/api/v1/subscribers/%s", sub.ID),
+		},
+		{
+			name:   "subscriber messages",
+			method: http.MethodPost,
+			path:   fmt.Sprintf("/api/v1/subscribers/%s/messages", sub.ID),
+			body:   `{"type": "test.created", "data": {}}`,
+		},
+		{
+			name:   "endpoint detail",
+			method: http.MethodGet,
+			path:   fmt.Sprintf("/api/v1/endpoints/%s", endpoint.ID),
+		},
+		{
+			name:   "endpoint delete",
+			method: http.MethodDelete,
+			path:   fmt.Sprintf("/api/v1/endpoints/%s", endpoint.ID),
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, bytes.NewReader([]byte(tt.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := other.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != http.StatusNotFound {
+				t.Fatalf("expected status %d but got %d", http.StatusNotFound, res.StatusCode)
+			}
+		})
+	}
+
+	res, err := owner.Get(fmt.Sprintf("%s/api/v1/endpoints/%s", srv.URL, endpoint.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, res.StatusCode)
+	}
+
+	res, err = other.Get(srv.URL + "/api/v1/subscribers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var list ListResponse[*Subscriber]
+	err = json.NewDecoder(res.Body).Decode(&list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Data) != 0 {
+		t.Fatalf("expected no subscribers but got %d", len(list.Data))
+	}
+}
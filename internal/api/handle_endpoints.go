@@ -1,46 +1,143 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"time"
 
 	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/retry"
 	"github.com/ffss92/webhookd/internal/validator"
 	"github.com/ffss92/webhookd/internal/webhook"
 	"github.com/google/uuid"
 )
 
 type Endpoint struct {
-	ID           uuid.UUID `json:"id"`
-	Label        string    `json:"label"`
-	URL          string    `json:"url"`
-	Disabled     bool      `json:"disabled"`
-	FilterTypes  []string  `json:"filter_types"`
-	SubscriberID uuid.UUID `json:"subscriber_id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           uuid.UUID      `json:"id"`
+	UID          *string        `json:"uid"`
+	Label        string         `json:"label"`
+	URL          string         `json:"url"`
+	Disabled     bool           `json:"disabled"`
+	FilterTypes  []string       `json:"filter_types"`
+	VersionPins  map[string]int `json:"version_pins"`
+	SubscriberID uuid.UUID      `json:"subscriber_id"`
+	// Retry delays in seconds, null when the default schedule is used.
+	RetrySchedule []int64 `json:"retry_schedule"`
+	// Concurrent deliveries allowed, 0 when the default limit is used.
+	MaxInFlight int       `json:"max_in_flight"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 func mapEndpoint(record *database.Endpoint) *Endpoint {
 	return &Endpoint{
-		ID:           record.ID,
-		Label:        record.Label,
-		URL:          record.URL,
-		Disabled:     record.Disabled,
-		FilterTypes:  record.FilterTypes,
-		SubscriberID: record.SubscriberID,
-		CreatedAt:    record.CreatedAt,
-		UpdatedAt:    record.UpdatedAt,
+		ID:            record.ID,
+		UID:           nullString(record.UID),
+		Label:         record.Label,
+		URL:           record.URL,
+		Disabled:      record.Disabled,
+		FilterTypes:   record.FilterTypes,
+		VersionPins:   record.VersionPins,
+		SubscriberID:  record.SubscriberID,
+		RetrySchedule: mapRetrySchedule(record.RetrySchedule),
+		MaxInFlight:   record.MaxInFlight,
+		CreatedAt:     record.CreatedAt,
+		UpdatedAt:     record.UpdatedAt,
 	}
 }
 
+func mapRetrySchedule(schedule []time.Duration) []int64 {
+	if len(schedule) == 0 {
+		return nil
+	}
+	seconds := make([]int64, 0, len(schedule))
+	for _, delay := range schedule {
+		seconds = append(seconds, int64(delay/time.Second))
+	}
+	return seconds
+}
+
+func parseRetrySchedule(seconds []int64) []time.Duration {
+	if len(seconds) == 0 {
+		return nil
+	}
+	schedule := make([]time.Duration, 0, len(seconds))
+	for _, s := range seconds {
+		schedule = append(schedule, time.Duration(s)*time.Second)
+	}
+	return schedule
+}
+
+const maxInFlight = 100
+
+func checkEndpointLabel(v *validator.Validator, label string) {
+	v.Check(validator.NotBlank(label), "label", "Must be provided")
+	v.Check(validator.MaxLength(label, 255), "label", "Must have at most 255 characters")
+}
+
+func checkEndpointURL(v *validator.Validator, url string) {
+	v.Check(validator.NotBlank(url), "url", "Must be provided")
+	v.Check(validator.HTTPUrl(url), "url", "Must be a valid http or https url")
+}
+
+func checkMaxInFlight(v *validator.Validator, n int) {
+	v.Check(n >= 0 && n <= maxInFlight, "max_in_flight", fmt.Sprintf("Must be between 0 and %d", maxInFlight))
+}
+
+// Custom secrets are optional, an empty secret means one is generated.
+func checkSecret(v *validator.Validator, secret string) {
+	if secret == "" {
+		return
+	}
+	_, err := webhook.ParseSecret(secret)
+	v.Check(err == nil, "secret", "Must be a whsec_ prefixed base64 encoded key of 24 to 64 bytes")
+}
+
+func checkRetrySchedule(v *validator.Validator, seconds []int64) {
+	// Clamped so out of range delays can't overflow into valid durations.
+	maxSeconds := int64(retry.MaxDelay / time.Second)
+	schedule := make([]time.Duration, 0, len(seconds))
+	for _, delay := range seconds {
+		schedule = append(schedule, time.Duration(min(max(delay, -1), maxSeconds+1))*time.Second)
+	}
+	err := retry.CheckSchedule(schedule)
+	v.Check(err == nil, "retry_schedule", fmt.Sprintf("Must start with 0 and have at most %d delays of up to %d seconds", retry.MaxAttempts, maxSeconds))
+}
+
+// Gets the endpoint identified by its id or by its uid, which is not found
+// when the API key can't access it.
+func (s *Server) getEndpoint(ctx context.Context, ref string) (*database.Endpoint, error) {
+	var endpoint *database.Endpoint
+	var err error
+	if id, parseErr := uuid.Parse(ref); parseErr == nil {
+		endpoint, err = s.appStore(ctx).GetEndpoint(ctx, id)
+	} else {
+		endpoint, err = s.appStore(ctx).GetEndpointByUID(ctx, ref)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess(ctx, endpoint.SubscriberID) {
+		return nil, database.ErrNotFound
+	}
+	return endpoint, nil
+}
+
 type CreateEndpointRequest struct {
-	Label        string    `json:"label"`
-	URL          string    `json:"url"`
-	FilterTypes  []string  `json:"filter_types"`
-	SubscriberID uuid.UUID `json:"subscriber_id"`
+	Label         string         `json:"label"`
+	URL           string         `json:"url"`
+	FilterTypes   []string       `json:"filter_types"`
+	VersionPins   map[string]int `json:"version_pins"`
+	SubscriberID  uuid.UUID      `json:"subscriber_id"`
+	RetrySchedule []int64        `json:"retry_schedule"`
+	MaxInFlight   int            `json:"max_in_flight"`
+	// Generated when empty.
+	Secret string `json:"secret"`
+	UID    string `json:"uid"`
 
 	validator.Validator `json:"-"`
 }
@@ -54,17 +151,32 @@ func (s *Server) handleEndpointCreate() http.HandlerFunc {
 			return
 		}
 
-		input.Check(validator.NotBlank(input.Label), "label", "Must be provided")
-		input.Check(validator.MaxLength(input.Label, 255), "label", "Must have at most 255 characters")
-		input.Check(validator.NotBlank(input.URL), "url", "Must be provided")
-		input.Check(validator.HTTPUrl(input.URL), "url", "Must be a valid http or https url")
+		checkEndpointLabel(&input.Validator, input.Label)
+		checkEndpointURL(&input.Validator, input.URL)
 		input.Check(input.SubscriberID != uuid.Nil, "subscriber_id", "Must not be an empty uuid")
+		checkRetrySchedule(&input.Validator, input.RetrySchedule)
+		checkMaxInFlight(&input.Validator, input.MaxInFlight)
+		checkSecret(&input.Validator, input.Secret)
+		checkUID(&input.Validator, input.UID)
+		err = s.checkFilterTypes(r.Context(), &input.Validator, input.FilterTypes)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+		err = s.checkVersionPins(r.Context(), &input.Validator, input.VersionPins)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
 		if !input.IsValid() {
 			s.validationError(w, r, input.FieldErrors)
 			return
 		}
 
-		sub, err := s.store.GetSubscriber(r.Context(), input.SubscriberID)
+		sub, err := s.appStore(r.Context()).GetSubscriber(r.Context(), input.SubscriberID)
+		if err == nil && !canAccess(r.Context(), sub.ID) {
+			err = database.ErrNotFound
+		}
 		if err != nil {
 			switch {
 			case errors.Is(err, database.ErrNotFound):
@@ -76,16 +188,30 @@ func (s *Server) handleEndpointCreate() http.HandlerFunc {
 			return
 		}
 
+		secret := input.Secret
+		if secret == "" {
+			secret = webhook.NewSecret()
+		}
+
 		endpoint := &database.Endpoint{
-			Label:        input.Label,
-			URL:          input.URL,
-			FilterTypes:  input.FilterTypes,
-			Secret:       webhook.NewSecret(),
-			SubscriberID: sub.ID,
+			Label:         input.Label,
+			URL:           input.URL,
+			FilterTypes:   input.FilterTypes,
+			VersionPins:   input.VersionPins,
+			Secret:        secret,
+			SubscriberID:  sub.ID,
+			RetrySchedule: parseRetrySchedule(input.RetrySchedule),
+			MaxInFlight:   input.MaxInFlight,
+			UID:           input.UID,
 		}
-		err = s.store.SaveEndpoint(r.Context(), endpoint)
+		err = s.appStore(r.Context()).SaveEndpoint(r.Context(), endpoint)
 		if err != nil {
-			s.serverError(w, r, err)
+			switch {
+			case errors.Is(err, database.ErrConflict):
+				s.conflict(w, r, "Endpoint uid is already in use")
+			default:
+				s.serverError(w, r, err)
+			}
 			return
 		}
 
@@ -93,15 +219,153 @@ func (s *Server) handleEndpointCreate() http.HandlerFunc {
 		s.writeJSON(w, r, http.StatusCreated, res)
 	}
 }
+
+// Fields follow JSON merge patch semantics: missing fields are left unchanged
+// and null resets optional fields to their default.
+type UpdateEndpointRequest struct {
+	Label         Optional[string]         `json:"label"`
+	URL           Optional[string]         `json:"url"`
+	Disabled      Optional[bool]           `json:"disabled"`
+	FilterTypes   Optional[[]string]       `json:"filter_types"`
+	VersionPins   Optional[map[string]int] `json:"version_pins"`
+	RetrySchedule Optional[[]int64]        `json:"retry_schedule"`
+	MaxInFlight   Optional[int]            `json:"max_in_flight"`
+	UID           Optional[string]         `json:"uid"`
+
+	validator.Validator `json:"-"`
+}
+
+func (s *Server) handleEndpointUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpointID := r.PathValue("endpointID")
+
+		var input UpdateEndpointRequest
+		err := json.NewDecoder(r.Body).Decode(&input)
+		if err != nil {
+			s.badRequest(w, r, err)
+			return
+		}
+
+		input.Check(!input.Label.Null, "label", "Must not be null")
+		if input.Label.Set {
+			checkEndpointLabel(&input.Validator, input.Label.Value)
+		}
+		input.Check(!input.URL.Null, "url", "Must not be null")
+		if input.URL.Set {
+			checkEndpointURL(&input.Validator, input.URL.Value)
+		}
+		input.Check(!input.Disabled.Null, "disabled", "Must not be null")
+		checkRetrySchedule(&input.Validator, input.RetrySchedule.Value)
+		checkMaxInFlight(&input.Validator, input.MaxInFlight.Value)
+		checkUID(&input.Validator, input.UID.Value)
+		err = s.checkFilterTypes(r.Context(), &input.Validator, input.FilterTypes.Value)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+		err = s.checkVersionPins(r.Context(), &input.Validator, input.VersionPins.Value)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+		if !input.IsValid() {
+			s.validationError(w, r, input.FieldErrors)
+			return
+		}
+
+		endpoint, err := s.getEndpoint(r.Context(), endpointID)
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				s.notFound(w, r)
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		if input.Label.Set {
+			endpoint.Label = input.Label.Value
+		}
+		if input.URL.Set {
+			endpoint.URL = input.URL.Value
+		}
+		if input.Disabled.Set {
+			endpoint.Disabled = input.Disabled.Value
+		}
+		if input.FilterTypes.Set {
+			endpoint.FilterTypes = input.FilterTypes.Value
+		}
+		if input.VersionPins.Set {
+			endpoint.VersionPins = input.VersionPins.Value
+		}
+		if input.RetrySchedule.Set {
+			endpoint.RetrySchedule = parseRetrySchedule(input.RetrySchedule.Value)
+		}
+		if input.MaxInFlight.Set {
+			endpoint.MaxInFlight = input.MaxInFlight.Value
+		}
+		if input.UID.Set {
+			endpoint.UID = input.UID.Value
+		}
+
+		err = s.appStore(r.Context()).UpdateEndpoint(r.Context(), endpoint)
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrConflict):
+				s.conflict(w, r, "Endpoint uid is already in use")
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusOK, mapEndpoint(endpoint))
+	}
+}
+
 func (s *Server) handleEndpointDetail() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		endpointID, err := uuidParam(r, "endpointID")
+		endpointID := r.PathValue("endpointID")
+
+		endpoint, err := s.getEndpoint(r.Context(), endpointID)
 		if err != nil {
-			s.notFound(w, r)
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				s.notFound(w, r)
+			default:
+				s.serverError(w, r, err)
+			}
 			return
 		}
 
-		endpoint, err := s.store.GetEndpoint(r.Context(), endpointID)
+		s.writeJSON(w, r, http.StatusOK, mapEndpoint(endpoint))
+	}
+}
+
+type EndpointSecret struct {
+	Secret string `json:"secret"`
+	// Set while the secret replaced by the last rotation still signs deliveries.
+	PreviousSecret          *string    `json:"previous_secret"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at"`
+}
+
+func mapEndpointSecret(record *database.Endpoint, now time.Time) *EndpointSecret {
+	secret := &EndpointSecret{
+		Secret: record.Secret,
+	}
+	if secrets := record.Secrets(now); len(secrets) > 1 {
+		secret.PreviousSecret = &secrets[1]
+		secret.PreviousSecretExpiresAt = record.PreviousSecretExpiresAt
+	}
+	return secret
+}
+
+func (s *Server) handleEndpointSecretDetail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpointID := r.PathValue("endpointID")
+
+		endpoint, err := s.getEndpoint(r.Context(), endpointID)
 		if err != nil {
 			switch {
 			case errors.Is(err, database.ErrNotFound):
@@ -112,19 +376,69 @@ func (s *Server) handleEndpointDetail() http.HandlerFunc {
 			return
 		}
 
-		s.writeJSON(w, r, http.StatusOK, endpoint)
+		s.writeJSON(w, r, http.StatusOK, mapEndpointSecret(endpoint, time.Now()))
 	}
 }
 
-func (s *Server) handleEndpointDelete() http.HandlerFunc {
+type RotateEndpointSecretRequest struct {
+	// Generated when empty.
+	Secret string `json:"secret"`
+
+	validator.Validator `json:"-"`
+}
+
+// Replaces the endpoint secret, with a new one or the one provided. Deliveries
+// are signed with both the new and the previous secret until the rotation
+// overlap ends.
+func (s *Server) handleEndpointSecretRotate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		endpointID, err := uuidParam(r, "endpointID")
+		endpointID := r.PathValue("endpointID")
+
+		// The request body is optional.
+		var input RotateEndpointSecretRequest
+		err := json.NewDecoder(r.Body).Decode(&input)
+		if err != nil && !errors.Is(err, io.EOF) {
+			s.badRequest(w, r, err)
+			return
+		}
+
+		checkSecret(&input.Validator, input.Secret)
+		if !input.IsValid() {
+			s.validationError(w, r, input.FieldErrors)
+			return
+		}
+
+		endpoint, err := s.getEndpoint(r.Context(), endpointID)
 		if err != nil {
-			s.notFound(w, r)
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				s.notFound(w, r)
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		secret := input.Secret
+		if secret == "" {
+			secret = webhook.NewSecret()
+		}
+
+		err = s.appStore(r.Context()).RotateEndpointSecret(r.Context(), endpoint, secret, s.cfg.SecretRotationOverlap)
+		if err != nil {
+			s.serverError(w, r, err)
 			return
 		}
 
-		endpoint, err := s.store.GetEndpoint(r.Context(), endpointID)
+		s.writeJSON(w, r, http.StatusOK, mapEndpointSecret(endpoint, time.Now()))
+	}
+}
+
+func (s *Server) handleEndpointDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpointID := r.PathValue("endpointID")
+
+		endpoint, err := s.getEndpoint(r.Context(), endpointID)
 		if err != nil {
 			switch {
 			case errors.Is(err, database.ErrNotFound):
@@ -135,7 +449,7 @@ func (s *Server) handleEndpointDelete() http.HandlerFunc {
 			return
 		}
 
-		err = s.store.DeleteEndpoint(r.Context(), endpoint.ID)
+		err = s.appStore(r.Context()).DeleteEndpoint(r.Context(), endpoint.ID)
 		if err != nil {
 			s.serverError(w, r, err)
 			return
@@ -144,3 +458,90 @@ func (s *Server) handleEndpointDelete() http.HandlerFunc {
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+func (s *Server) handleEndpointAttemptList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpointID := r.PathValue("endpointID")
+
+		endpoint, err := s.getEndpoint(r.Context(), endpointID)
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				s.notFound(w, r)
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		attempts, err := s.appStore(r.Context()).ListAttempts(r.Context(), database.ListAttemptsParams{
+			EndpointID: &endpoint.ID,
+			Limit:      limitParam(r),
+		})
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusOK, mapAttempts(attempts))
+	}
+}
+
+type Delivery struct {
+	MessageID     uuid.UUID  `json:"message_id"`
+	EndpointID    uuid.UUID  `json:"endpoint_id"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	LastAttemptAt *time.Time `json:"last_attempt_at"`
+}
+
+func mapDelivery(record *database.Delivery) *Delivery {
+	return &Delivery{
+		MessageID:     record.MessageID,
+		EndpointID:    record.EndpointID,
+		Status:        string(record.Status),
+		Attempts:      record.Attempts,
+		NextAttemptAt: record.NextAttemptAt,
+		LastAttemptAt: record.LastAttemptAt,
+	}
+}
+
+// Schedules an immediate delivery attempt of a message to the endpoint, also
+// when previous attempts have been exhausted.
+func (s *Server) handleEndpointMessageRetry() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		endpointID := r.PathValue("endpointID")
+		msgID, err := uuidParam(r, "msgID")
+		if err != nil {
+			s.notFound(w, r)
+			return
+		}
+
+		endpoint, err := s.getEndpoint(r.Context(), endpointID)
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				s.notFound(w, r)
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		delivery, err := s.appStore(r.Context()).RetryDelivery(r.Context(), msgID, endpoint.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				s.notFound(w, r)
+			case errors.Is(err, database.ErrConflict):
+				s.conflict(w, r, "Delivery is being attempted")
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusAccepted, mapDelivery(delivery))
+	}
+}
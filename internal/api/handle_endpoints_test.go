@@ -0,0 +1,823 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/auth"
+	"github.com/ffss92/webhookd/internal/config"
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/webhook"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestHandleEndpointAttemptList(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	sub := &database.Subscriber{
+		Name: "test",
+	}
+	err := api.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &database.Endpoint{
+		Label:        "test",
+		URL:          "http://test.com",
+		SubscriberID: sub.ID,
+	}
+	err = api.store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &database.Message{
+		Type:         "test.created",
+		Data:         json.RawMessage(`{}`),
+		SubscriberID: sub.ID,
+	}
+	err = api.store.SaveMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := []*database.Attempt{
+		{
+			MessageID:  msg.ID,
+			EndpointID: endpoint.ID,
+			StatusCode: http.StatusInternalServerError,
+			Error:      "unexpected status code: 500",
+		},
+		{
+			MessageID:  msg.ID,
+			EndpointID: endpoint.ID,
+			StatusCode: http.StatusOK,
+		},
+	}
+	for _, attempt := range attempts {
+		err = api.store.SaveAttempt(t.Context(), attempt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		endpointID string
+		query      string
+		expected   []*Attempt
+		status     int
+	}{
+		{
+			name:       "valid id",
+			endpointID: endpoint.ID.String(),
+			expected: []*Attempt{
+				mapAttempt(attempts[1]),
+				mapAttempt(attempts[0]),
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:       "with limit",
+			endpointID: endpoint.ID.String(),
+			query:      "?limit=1",
+			expected: []*Attempt{
+				mapAttempt(attempts[1]),
+			},
+			status: http.StatusOK,
+		},
+		{
+			name:       "non existing id",
+			endpointID: uuid.NewString(),
+			status:     http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			path := fmt.Sprintf("/api/v1/endpoints/%s/attempts%s", tt.endpointID, tt.query)
+			req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := authClient(t, srv, api.store, auth.ScopeAdmin)
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+
+			if tt.status == http.StatusOK {
+				var got []*Attempt
+				err := json.NewDecoder(res.Body).Decode(&got)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(tt.expected, got); diff != "" {
+					t.Fatalf("mismatch (-want, +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleEndpointCreate(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	sub := &database.Subscriber{
+		Name: "test",
+	}
+	err := api.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveEventTypes(t, api.store, "test.created")
+
+	testCases := []struct {
+		name   string
+		req    *CreateEndpointRequest
+		status int
+	}{
+		{
+			name: "valid request",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: sub.ID,
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name: "valid request (retry schedule)",
+			req: &CreateEndpointRequest{
+				Label:         "test",
+				URL:           "https://test.com/webhooks",
+				SubscriberID:  sub.ID,
+				RetrySchedule: []int64{0, 60, 3600},
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name: "invalid retry schedule",
+			req: &CreateEndpointRequest{
+				Label:         "test",
+				URL:           "https://test.com/webhooks",
+				SubscriberID:  sub.ID,
+				RetrySchedule: []int64{-1},
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "delayed first attempt",
+			req: &CreateEndpointRequest{
+				Label:         "test",
+				URL:           "https://test.com/webhooks",
+				SubscriberID:  sub.ID,
+				RetrySchedule: []int64{60, 3600},
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "valid request (max in flight)",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: sub.ID,
+				MaxInFlight:  1,
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name: "invalid max in flight",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: sub.ID,
+				MaxInFlight:  -1,
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "valid request (custom secret)",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: sub.ID,
+				Secret:       webhook.NewSecret(),
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name: "invalid secret",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: sub.ID,
+				Secret:       "not-a-secret",
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "valid request (filter patterns)",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: sub.ID,
+				FilterTypes:  []string{"test.created", "invoice.*", "**.failed"},
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name: "invalid filter pattern",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: sub.ID,
+				FilterTypes:  []string{"invoice.pa*"},
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "unregistered filter type",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: sub.ID,
+				FilterTypes:  []string{"invoice.paid"},
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "valid request (version pins)",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: sub.ID,
+				VersionPins:  map[string]int{"test.created": 1},
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name: "unknown pinned version",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: sub.ID,
+				VersionPins:  map[string]int{"test.created": 2},
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "unknown pinned type",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: sub.ID,
+				VersionPins:  map[string]int{"test.unknown": 1},
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "invalid url",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "ftp://test.com",
+				SubscriberID: sub.ID,
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "valid request (uid)",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: sub.ID,
+				UID:          "endpoint_1",
+			},
+			status: http.StatusCreated,
+		},
+		{
+			name: "duplicate uid",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: sub.ID,
+				UID:          "endpoint_1",
+			},
+			status: http.StatusConflict,
+		},
+		{
+			name: "uuid uid",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: sub.ID,
+				UID:          uuid.NewString(),
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name: "non existing subscriber",
+			req: &CreateEndpointRequest{
+				Label:        "test",
+				URL:          "https://test.com/webhooks",
+				SubscriberID: uuid.New(),
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/endpoints", bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := authClient(t, srv, api.store, auth.ScopeAdmin)
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+
+			if res.StatusCode == http.StatusCreated {
+				var got Endpoint
+				err := json.NewDecoder(res.Body).Decode(&got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if diff := cmp.Diff(tt.req.RetrySchedule, got.RetrySchedule); diff != "" {
+					t.Fatalf("retry schedule mismatch (-want, +got):\n%s", diff)
+				}
+				if got.MaxInFlight != tt.req.MaxInFlight {
+					t.Fatalf("expected max_in_flight %d but got %d", tt.req.MaxInFlight, got.MaxInFlight)
+				}
+				if tt.req.UID != "" && (got.UID == nil || *got.UID != tt.req.UID) {
+					t.Fatalf("expected uid %q but got %v", tt.req.UID, got.UID)
+				}
+			}
+		})
+	}
+
+	// Endpoints can be referenced by their uid.
+	client := authClient(t, srv, api.store, auth.ScopeAdmin)
+	res, err := client.Get(srv.URL + "/api/v1/endpoints/endpoint_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d but got %d", http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestHandleEndpointUpdate(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	sub := &database.Subscriber{
+		Name: "test",
+	}
+	err := api.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveEventTypes(t, api.store, "test.created")
+
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+		check  func(t *testing.T, before, after *Endpoint)
+	}{
+		{
+			name:   "update url",
+			body:   `{"url": "https://fixed.com/webhooks"}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, before, after *Endpoint) {
+				if after.URL != "https://fixed.com/webhooks" {
+					t.Fatalf("expected url to be updated but got %q", after.URL)
+				}
+				if after.Label != before.Label {
+					t.Fatalf("expected label to be unchanged but got %q", after.Label)
+				}
+			},
+		},
+		{
+			name:   "disable and filter",
+			body:   `{"disabled": true, "filter_types": ["test.created"]}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, before, after *Endpoint) {
+				if !after.Disabled {
+					t.Fatal("expected endpoint to be disabled")
+				}
+				if diff := cmp.Diff([]string{"test.created"}, after.FilterTypes); diff != "" {
+					t.Fatalf("mismatch (-want, +got):\n%s", diff)
+				}
+			},
+		},
+		{
+			name:   "unknown filter type",
+			body:   `{"filter_types": ["test.created", "test.unknown"]}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "reset retry schedule",
+			body:   `{"retry_schedule": null, "max_in_flight": null}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, before, after *Endpoint) {
+				if after.RetrySchedule != nil || after.MaxInFlight != 0 {
+					t.Fatalf("expected defaults to be restored: %+v", after)
+				}
+			},
+		},
+		{
+			name:   "null label",
+			body:   `{"label": null}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "invalid url",
+			body:   `{"url": "ftp://test.com"}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "invalid json",
+			body:   `{"label":`,
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := &database.Endpoint{
+				Label:         "test",
+				URL:           "https://test.com/webhooks",
+				SubscriberID:  sub.ID,
+				RetrySchedule: []time.Duration{0, time.Minute},
+				MaxInFlight:   2,
+			}
+			err := api.store.SaveEndpoint(t.Context(), endpoint)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			url := fmt.Sprintf("%s/api/v1/endpoints/%s", srv.URL, endpoint.ID)
+			req, err := http.NewRequest(http.MethodPatch, url, bytes.NewReader([]byte(tt.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := authClient(t, srv, api.store, auth.ScopeAdmin)
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+
+			if tt.check != nil {
+				var got Endpoint
+				err := json.NewDecoder(res.Body).Decode(&got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tt.check(t, mapEndpoint(endpoint), &got)
+			}
+		})
+	}
+}
+
+func TestHandleEndpointSecretRotate(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		cfg:   &config.Config{SecretRotationOverlap: time.Hour},
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	sub := &database.Subscriber{
+		Name: "test",
+	}
+	err := api.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &database.Endpoint{
+		Label:        "test",
+		URL:          "https://test.com/webhooks",
+		Secret:       webhook.NewSecret(),
+		SubscriberID: sub.ID,
+	}
+	err = api.store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	custom := webhook.NewSecret()
+
+	testCases := []struct {
+		name       string
+		endpointID string
+		body       string
+		status     int
+		secret     string
+	}{
+		{
+			name:       "generated secret",
+			endpointID: endpoint.ID.String(),
+			status:     http.StatusOK,
+		},
+		{
+			name:       "custom secret",
+			endpointID: endpoint.ID.String(),
+			body:       fmt.Sprintf(`{"secret": %q}`, custom),
+			status:     http.StatusOK,
+			secret:     custom,
+		},
+		{
+			name:       "invalid secret",
+			endpointID: endpoint.ID.String(),
+			body:       `{"secret": "whsec_c2hvcnQ="}`,
+			status:     http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "non existing endpoint",
+			endpointID: uuid.NewString(),
+			status:     http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := api.store.GetEndpoint(t.Context(), endpoint.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			url := fmt.Sprintf("%s/api/v1/endpoints/%s/secret/rotate", srv.URL, tt.endpointID)
+			req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader([]byte(tt.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := authClient(t, srv, api.store, auth.ScopeAdmin)
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+
+			if res.StatusCode == http.StatusOK {
+				var got EndpointSecret
+				err := json.NewDecoder(res.Body).Decode(&got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Secret == before.Secret || (tt.secret != "" && got.Secret != tt.secret) {
+					t.Fatalf("unexpected rotated secret %q", got.Secret)
+				}
+				if got.PreviousSecret == nil || *got.PreviousSecret != before.Secret {
+					t.Fatalf("expected previous secret to be valid during the overlap: %+v", got)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleEndpointSecretDetail(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	sub := &database.Subscriber{
+		Name: "test",
+	}
+	err := api.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &database.Endpoint{
+		Label:        "test",
+		URL:          "https://test.com/webhooks",
+		Secret:       webhook.NewSecret(),
+		SubscriberID: sub.ID,
+	}
+	err = api.store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name       string
+		endpointID string
+		status     int
+	}{
+		{
+			name:       "valid request",
+			endpointID: endpoint.ID.String(),
+			status:     http.StatusOK,
+		},
+		{
+			name:       "non existing endpoint",
+			endpointID: uuid.NewString(),
+			status:     http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			url := fmt.Sprintf("%s/api/v1/endpoints/%s/secret", srv.URL, tt.endpointID)
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := authClient(t, srv, api.store, auth.ScopeAdmin)
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+
+			if res.StatusCode == http.StatusOK {
+				var got EndpointSecret
+				err := json.NewDecoder(res.Body).Decode(&got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := EndpointSecret{Secret: endpoint.Secret}
+				if diff := cmp.Diff(want, got); diff != "" {
+					t.Fatalf("mismatch (-want, +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleEndpointMessageRetry(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	sub := &database.Subscriber{
+		Name: "test",
+	}
+	err := api.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &database.Endpoint{
+		Label:        "test",
+		URL:          "https://test.com/webhooks",
+		Secret:       webhook.NewSecret(),
+		SubscriberID: sub.ID,
+	}
+	err = api.store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &database.Message{
+		Type:         "test.created",
+		Data:         json.RawMessage(`{}`),
+		SubscriberID: sub.ID,
+	}
+	err = api.store.SaveMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = api.store.SaveDeliveries(t.Context(), msg.ID, []uuid.UUID{endpoint.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name       string
+		endpointID string
+		msgID      string
+		status     int
+	}{
+		{
+			name:       "valid request",
+			endpointID: endpoint.ID.String(),
+			msgID:      msg.ID.String(),
+			status:     http.StatusAccepted,
+		},
+		{
+			name:       "non existing delivery",
+			endpointID: endpoint.ID.String(),
+			msgID:      uuid.NewString(),
+			status:     http.StatusNotFound,
+		},
+		{
+			name:       "non existing endpoint",
+			endpointID: uuid.NewString(),
+			msgID:      msg.ID.String(),
+			status:     http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			url := fmt.Sprintf("%s/api/v1/endpoints/%s/messages/%s/retry", srv.URL, tt.endpointID, tt.msgID)
+			req, err := http.NewRequest(http.MethodPost, url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := authClient(t, srv, api.store, auth.ScopeAttemptsWrite)
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,464 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/filter"
+	"github.com/ffss92/webhookd/internal/schema"
+	"github.com/ffss92/webhookd/internal/transform"
+	"github.com/ffss92/webhookd/internal/validator"
+	"github.com/google/uuid"
+)
+
+type EventType struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Version     int       `json:"version"`
+	// Schema of the current version.
+	Schema     json.RawMessage `json:"schema"`
+	Deprecated bool            `json:"deprecated"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+func mapEventType(record *database.EventType) *EventType {
+	return &EventType{
+		ID:          record.ID,
+		Name:        record.Name,
+		Description: record.Description,
+		Version:     record.Version,
+		Schema:      record.Schema,
+		Deprecated:  record.Deprecated,
+		CreatedAt:   record.CreatedAt,
+		UpdatedAt:   record.UpdatedAt,
+	}
+}
+
+func mapEventTypes(records []*database.EventType) []*EventType {
+	res := make([]*EventType, 0, len(records))
+	for _, record := range records {
+		res = append(res, mapEventType(record))
+	}
+	return res
+}
+
+func checkEventTypeName(v *validator.Validator, field, name string) {
+	v.Check(validator.NotBlank(name), field, "Must be provided")
+	v.Check(validator.MaxLength(name, 255), field, "Must have at most 255 characters")
+	v.Check(validator.Matches(name, eventTypeRx), field, "Must be dot separated words of letters, digits, '_' or '-'")
+}
+
+func checkEventTypeDescription(v *validator.Validator, description string) {
+	v.Check(validator.MaxLength(description, 1024), "description", "Must have at most 1024 characters")
+}
+
+// A missing or null schema accepts any payload.
+func checkEventTypeSchema(v *validator.Validator, raw json.RawMessage) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return
+	}
+	_, err := schema.Compile(raw)
+	v.Check(err == nil, "schema", "Must be a valid JSON Schema without remote references")
+}
+
+// Reports the filter types that are not in the event type catalog, and
+// wildcard patterns with an invalid syntax. Patterns may match types that are
+// not registered yet.
+func (s *Server) checkFilterTypes(ctx context.Context, v *validator.Validator, filterTypes []string) error {
+	names := make([]string, 0, len(filterTypes))
+	for _, filterType := range filterTypes {
+		if !filter.IsPattern(filterType) {
+			names = append(names, filterType)
+			continue
+		}
+		_, err := filter.Regexp(filterType)
+		v.Check(err == nil, "filter_types", "Patterns must be dot separated words of letters, digits, '_' or '-', '*' matching one word or '**' matching many")
+	}
+
+	missing, err := s.appStore(ctx).MissingEventTypes(ctx, names)
+	if err != nil {
+		return err
+	}
+	v.Check(len(missing) == 0, "filter_types", fmt.Sprintf("Must only contain registered event types, unknown: %s", strings.Join(missing, ", ")))
+	return nil
+}
+
+// Checks the message type is registered and its data satisfies the schema of
+// the given version, the current one when zero. Schema violations are
+// reported as "data" or "data.<path>" fields. Returns the version the data
+// follows.
+func (s *Server) checkMessageData(ctx context.Context, v *validator.Validator, eventType string, version int, data json.RawMessage) (int, error) {
+	store := s.appStore(ctx)
+	record, err := store.GetEventType(ctx, eventType)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			v.SetFieldError("type", "Must be a registered event type")
+			return 0, nil
+		default:
+			return 0, err
+		}
+	}
+
+	raw := record.Schema
+	switch {
+	case version == 0:
+		version = record.Version
+	case version < 0 || version > record.Version:
+		v.SetFieldError("version", fmt.Sprintf("Must be between 1 and %d", record.Version))
+		return 0, nil
+	case version < record.Version:
+		eventTypeVersion, err := store.GetEventTypeVersion(ctx, record.ID, version)
+		if err != nil {
+			return 0, err
+		}
+		raw = eventTypeVersion.Schema
+	}
+	if len(raw) == 0 {
+		return version, nil
+	}
+
+	compiled, err := schema.Compile(raw)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compile schema of %q version %d: %w", record.Name, version, err)
+	}
+	fieldErrs, err := compiled.Validate(data)
+	if err != nil {
+		return 0, err
+	}
+	for _, fieldErr := range fieldErrs {
+		field := "data"
+		if fieldErr.Field != "" {
+			field += "." + fieldErr.Field
+		}
+		v.SetFieldError(field, fieldErr.Description)
+	}
+	return version, nil
+}
+
+const maxVersionPins = 50
+
+// Checks pinned event types are registered and pinned to one of their
+// versions.
+func (s *Server) checkVersionPins(ctx context.Context, v *validator.Validator, pins map[string]int) error {
+	if len(pins) > maxVersionPins {
+		v.SetFieldError("version_pins", fmt.Sprintf("Must have at most %d entries", maxVersionPins))
+		return nil
+	}
+	for name, version := range pins {
+		eventType, err := s.appStore(ctx).GetEventType(ctx, name)
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				v.SetFieldError("version_pins", "Must only pin registered event types")
+				return nil
+			default:
+				return err
+			}
+		}
+		v.Check(version >= 1 && version <= eventType.Version, "version_pins", fmt.Sprintf("Versions of %q must be between 1 and %d", name, eventType.Version))
+	}
+	return nil
+}
+
+func (s *Server) handleEventTypeList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventTypes, err := s.appStore(r.Context()).ListEventTypes(r.Context())
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusOK, mapEventTypes(eventTypes))
+	}
+}
+
+func (s *Server) handleEventTypeDetail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		eventType, err := s.appStore(r.Context()).GetEventType(r.Context(), r.PathValue("name"))
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				s.notFound(w, r)
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusOK, mapEventType(eventType))
+	}
+}
+
+type CreateEventTypeRequest struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Schema      json.RawMessage `json:"schema"`
+	Deprecated  bool            `json:"deprecated"`
+
+	validator.Validator `json:"-"`
+}
+
+func (s *Server) handleEventTypeCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The catalog is shared by the whole application.
+		if getAPIKey(r.Context()).SubscriberID != nil {
+			s.forbidden(w, r)
+			return
+		}
+
+		var input CreateEventTypeRequest
+		err := json.NewDecoder(r.Body).Decode(&input)
+		if err != nil {
+			s.badRequest(w, r, err)
+			return
+		}
+
+		input.Name = strings.TrimSpace(input.Name)
+		checkEventTypeName(&input.Validator, "name", input.Name)
+		checkEventTypeDescription(&input.Validator, input.Description)
+		checkEventTypeSchema(&input.Validator, input.Schema)
+		if !input.IsValid() {
+			s.validationError(w, r, input.FieldErrors)
+			return
+		}
+
+		eventType := &database.EventType{
+			Name:        input.Name,
+			Description: input.Description,
+			Deprecated:  input.Deprecated,
+		}
+		if string(input.Schema) != "null" {
+			eventType.Schema = input.Schema
+		}
+		err = s.appStore(r.Context()).SaveEventType(r.Context(), eventType)
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrConflict):
+				s.conflict(w, r, "Event type already exists")
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusCreated, mapEventType(eventType))
+	}
+}
+
+// Fields follow JSON merge patch semantics. Schemas are immutable once
+// created since messages were validated against them, so they change by
+// adding a version through the versions route. Names can't be changed since
+// producers and filters refer to them.
+type UpdateEventTypeRequest struct {
+	Description Optional[string]          `json:"description"`
+	Schema      Optional[json.RawMessage] `json:"schema"`
+	Deprecated  Optional[bool]            `json:"deprecated"`
+
+	validator.Validator `json:"-"`
+}
+
+func (s *Server) handleEventTypeUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if getAPIKey(r.Context()).SubscriberID != nil {
+			s.forbidden(w, r)
+			return
+		}
+
+		var input UpdateEventTypeRequest
+		err := json.NewDecoder(r.Body).Decode(&input)
+		if err != nil {
+			s.badRequest(w, r, err)
+			return
+		}
+
+		input.Check(!input.Description.Null, "description", "Must not be null")
+		checkEventTypeDescription(&input.Validator, input.Description.Value)
+		input.Check(!input.Schema.Set, "schema", "Must be changed by adding a version")
+		input.Check(!input.Deprecated.Null, "deprecated", "Must not be null")
+		if !input.IsValid() {
+			s.validationError(w, r, input.FieldErrors)
+			return
+		}
+
+		store := s.appStore(r.Context())
+		eventType, err := store.GetEventType(r.Context(), r.PathValue("name"))
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				s.notFound(w, r)
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		if input.Description.Set {
+			eventType.Description = input.Description.Value
+		}
+		if input.Deprecated.Set {
+			eventType.Deprecated = input.Deprecated.Value
+		}
+
+		err = store.UpdateEventType(r.Context(), eventType)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusOK, mapEventType(eventType))
+	}
+}
+
+// Removes the type from the catalog. Messages already sent keep their type,
+// but new messages of this type are rejected.
+func (s *Server) handleEventTypeDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if getAPIKey(r.Context()).SubscriberID != nil {
+			s.forbidden(w, r)
+			return
+		}
+
+		store := s.appStore(r.Context())
+		eventType, err := store.GetEventType(r.Context(), r.PathValue("name"))
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				s.notFound(w, r)
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		err = store.DeleteEventType(r.Context(), eventType.ID)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type EventTypeVersion struct {
+	Version   int             `json:"version"`
+	Schema    json.RawMessage `json:"schema"`
+	Transform json.RawMessage `json:"transform"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func mapEventTypeVersion(record *database.EventTypeVersion) *EventTypeVersion {
+	return &EventTypeVersion{
+		Version:   record.Version,
+		Schema:    record.Schema,
+		Transform: record.Transform,
+		CreatedAt: record.CreatedAt,
+	}
+}
+
+func mapEventTypeVersions(records []*database.EventTypeVersion) []*EventTypeVersion {
+	res := make([]*EventTypeVersion, 0, len(records))
+	for _, record := range records {
+		res = append(res, mapEventTypeVersion(record))
+	}
+	return res
+}
+
+func (s *Server) handleEventTypeVersionList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		store := s.appStore(r.Context())
+		eventType, err := store.GetEventType(r.Context(), r.PathValue("name"))
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				s.notFound(w, r)
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		versions, err := store.ListEventTypeVersions(r.Context(), eventType.ID)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusOK, mapEventTypeVersions(versions))
+	}
+}
+
+// The transform converts data of the new version to the previous one, it is
+// applied when delivering to endpoints pinned to older versions.
+type CreateEventTypeVersionRequest struct {
+	Schema    json.RawMessage `json:"schema"`
+	Transform json.RawMessage `json:"transform"`
+
+	validator.Validator `json:"-"`
+}
+
+// Adds a version to the event type, which becomes its current version.
+func (s *Server) handleEventTypeVersionCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if getAPIKey(r.Context()).SubscriberID != nil {
+			s.forbidden(w, r)
+			return
+		}
+
+		var input CreateEventTypeVersionRequest
+		err := json.NewDecoder(r.Body).Decode(&input)
+		if err != nil {
+			s.badRequest(w, r, err)
+			return
+		}
+
+		checkEventTypeSchema(&input.Validator, input.Schema)
+		_, err = transform.Parse(input.Transform)
+		input.Check(err == nil, "transform", "Must be a list of rename, copy, set or remove operations on dot separated paths")
+		if !input.IsValid() {
+			s.validationError(w, r, input.FieldErrors)
+			return
+		}
+
+		store := s.appStore(r.Context())
+		eventType, err := store.GetEventType(r.Context(), r.PathValue("name"))
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				s.notFound(w, r)
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		version := &database.EventTypeVersion{}
+		if string(input.Schema) != "null" {
+			version.Schema = input.Schema
+		}
+		if string(input.Transform) != "null" {
+			version.Transform = input.Transform
+		}
+		err = store.SaveEventTypeVersion(r.Context(), eventType, version)
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				s.notFound(w, r)
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusCreated, mapEventTypeVersion(version))
+	}
+}
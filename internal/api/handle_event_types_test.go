@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ffss92/webhookd/internal/auth"
+	"github.com/ffss92/webhookd/internal/database"
+)
+
+func TestHandleEventTypeCreate(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	saveEventTypes(t, api.store, "invoice.paid")
+
+	sub := &database.Subscriber{Name: "test"}
+	err := api.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name   string
+		key    *database.APIKey
+		body   string
+		status int
+	}{
+		{
+			name:   "valid request",
+			key:    &database.APIKey{Scopes: []string{auth.ScopeEventTypesWrite}},
+			body:   `{"name": "invoice.created", "description": "An invoice was created"}`,
+			status: http.StatusCreated,
+		},
+		{
+			name:   "with schema",
+			key:    &database.APIKey{Scopes: []string{auth.ScopeEventTypesWrite}},
+			body:   `{"name": "invoice.voided", "schema": {"type": "object", "required": ["id"]}}`,
+			status: http.StatusCreated,
+		},
+		{
+			name:   "duplicate name",
+			key:    &database.APIKey{Scopes: []string{auth.ScopeEventTypesWrite}},
+			body:   `{"name": "invoice.paid"}`,
+			status: http.StatusConflict,
+		},
+		{
+			name:   "invalid name",
+			key:    &database.APIKey{Scopes: []string{auth.ScopeEventTypesWrite}},
+			body:   `{"name": "invoice..paid"}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "invalid schema",
+			key:    &database.APIKey{Scopes: []string{auth.ScopeEventTypesWrite}},
+			body:   `{"name": "invoice.sent", "schema": {"type": "unknown"}}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "remote reference",
+			key:    &database.APIKey{Scopes: []string{auth.ScopeEventTypesWrite}},
+			body:   `{"name": "invoice.sent", "schema": {"$ref": "http://169.254.169.254/schema.json"}}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "subscriber key",
+			key:    &database.APIKey{Scopes: []string{auth.ScopeEventTypesWrite}, SubscriberID: &sub.ID},
+			body:   `{"name": "invoice.sent"}`,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "missing scope",
+			key:    &database.APIKey{Scopes: []string{auth.ScopeEventTypesRead}},
+			body:   `{"name": "invoice.sent"}`,
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/event-types", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := keyClient(t, srv, api.store, tt.key).Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHandleEventTypeUpdate(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	err := api.store.SaveEventType(t.Context(), &database.EventType{
+		Name:        "invoice.paid",
+		Description: "An invoice was paid",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name   string
+		path   string
+		body   string
+		status int
+		check  func(t *testing.T, got *EventType)
+	}{
+		{
+			name:   "deprecate",
+			path:   "/api/v1/event-types/invoice.paid",
+			body:   `{"deprecated": true}`,
+			status: http.StatusOK,
+			check: func(t *testing.T, got *EventType) {
+				if !got.Deprecated {
+					t.Fatal("expected event type to be deprecated")
+				}
+				if got.Description != "An invoice was paid" {
+					t.Fatalf("expected description to be unchanged but got %q", got.Description)
+				}
+			},
+		},
+		{
+			name:   "null description",
+			path:   "/api/v1/event-types/invoice.paid",
+			body:   `{"description": null}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "schema",
+			path:   "/api/v1/event-types/invoice.paid",
+			body:   `{"schema": {"type": "object"}}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "unknown event type",
+			path:   "/api/v1/event-types/invoice.unknown",
+			body:   `{"deprecated": true}`,
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPatch, srv.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := authClient(t, srv, api.store, auth.ScopeEventTypesWrite).Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+
+			if tt.check != nil {
+				var got EventType
+				err := json.NewDecoder(res.Body).Decode(&got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tt.check(t, &got)
+			}
+		})
+	}
+}
+
+func TestHandleEventTypeVersionCreate(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	saveEventTypes(t, api.store, "invoice.paid")
+
+	testCases := []struct {
+		name    string
+		path    string
+		body    string
+		status  int
+		version int
+	}{
+		{
+			name:    "valid request",
+			path:    "/api/v1/event-types/invoice.paid/versions",
+			body:    `{"schema": {"required": ["amount"]}, "transform": [{"op": "remove", "path": "amount"}]}`,
+			status:  http.StatusCreated,
+			version: 2,
+		},
+		{
+			name:    "without transform",
+			path:    "/api/v1/event-types/invoice.paid/versions",
+			body:    `{"schema": {"required": ["amount"]}}`,
+			status:  http.StatusCreated,
+			version: 3,
+		},
+		{
+			name:   "invalid transform",
+			path:   "/api/v1/event-types/invoice.paid/versions",
+			body:   `{"transform": [{"op": "move", "path": "amount"}]}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "invalid schema",
+			path:   "/api/v1/event-types/invoice.paid/versions",
+			body:   `{"schema": []}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "unknown event type",
+			path:   "/api/v1/event-types/invoice.unknown/versions",
+			body:   `{}`,
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, srv.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := authClient(t, srv, api.store, auth.ScopeEventTypesWrite).Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+
+			if res.StatusCode == http.StatusCreated {
+				var got EventTypeVersion
+				err := json.NewDecoder(res.Body).Decode(&got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Version != tt.version {
+					t.Fatalf("expected version %d but got %d", tt.version, got.Version)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/validator"
+	"github.com/google/uuid"
+)
+
+const (
+	maxMessageDataSize = 256 << 10
+	maxMessageTags     = 10
+
+	idempotencyKeyHeader = "Idempotency-Key"
+)
+
+var (
+	eventTypeRx = regexp.MustCompile(`^[a-zA-Z0-9_-]+(\.[a-zA-Z0-9_-]+)*$`)
+)
+
+type Message struct {
+	ID           uuid.UUID       `json:"id"`
+	Type         string          `json:"type"`
+	Version      int             `json:"version"`
+	Data         json.RawMessage `json:"data"`
+	Tags         []string        `json:"tags"`
+	SubscriberID uuid.UUID       `json:"subscriber_id"`
+	EventID      string          `json:"event_id,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+func mapMessage(record *database.Message) *Message {
+	return &Message{
+		ID:           record.ID,
+		Type:         record.Type,
+		Version:      record.Version,
+		Data:         record.Data,
+		Tags:         record.Tags,
+		SubscriberID: record.SubscriberID,
+		EventID:      record.IdempotencyKey,
+		CreatedAt:    record.CreatedAt,
+	}
+}
+
+type Attempt struct {
+	ID              uuid.UUID           `json:"id"`
+	MessageID       uuid.UUID           `json:"message_id"`
+	EndpointID      uuid.UUID           `json:"endpoint_id"`
+	Attempt         int                 `json:"attempt"`
+	StatusCode      int                 `json:"status_code"`
+	ResponseHeaders map[string][]string `json:"response_headers"`
+	ResponseBody    string              `json:"response_body"`
+	LatencyMs       int64               `json:"latency_ms"`
+	Error           string              `json:"error"`
+	CreatedAt       time.Time           `json:"created_at"`
+}
+
+func mapAttempt(record *database.Attempt) *Attempt {
+	return &Attempt{
+		ID:              record.ID,
+		MessageID:       record.MessageID,
+		EndpointID:      record.EndpointID,
+		Attempt:         record.Attempt,
+		StatusCode:      record.StatusCode,
+		ResponseHeaders: record.ResponseHeaders,
+		ResponseBody:    record.ResponseBody,
+		LatencyMs:       record.Latency.Milliseconds(),
+		Error:           record.Error,
+		CreatedAt:       record.CreatedAt,
+	}
+}
+
+func mapAttempts(records []*database.Attempt) []*Attempt {
+	res := make([]*Attempt, 0, len(records))
+	for _, record := range records {
+		res = append(res, mapAttempt(record))
+	}
+	return res
+}
+
+func (s *Server) handleMessageAttemptList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		msgID, err := uuidParam(r, "msgID")
+		if err != nil {
+			s.notFound(w, r)
+			return
+		}
+
+		msg, err := s.appStore(r.Context()).GetMessage(r.Context(), msgID)
+		if err == nil && !canAccess(r.Context(), msg.SubscriberID) {
+			err = database.ErrNotFound
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrNotFound):
+				s.notFound(w, r)
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		attempts, err := s.appStore(r.Context()).ListAttempts(r.Context(), database.ListAttemptsParams{
+			MessageID: &msg.ID,
+			Limit:     limitParam(r),
+		})
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusOK, mapAttempts(attempts))
+	}
+}
+
+type CreateMessageRequest struct {
+	Type string `json:"type"`
+	// Version of the event type the data follows, the current one when
+	// omitted.
+	Version int             `json:"version,omitempty"`
+	Data    json.RawMessage `json:"data"`
+	Tags    []string        `json:"tags"`
+	// Alternative to the Idempotency-Key header.
+	EventID string `json:"event_id,omitempty"`
+
+	validator.Validator `json:"-"`
+}
+
+type CreateMessageResponse struct {
+	Message   *Message    `json:"message"`
+	Endpoints []*Endpoint `json:"endpoints"`
+}
+
+func (s *Server) handleSubscriberMessageCreate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sub := getSubscriber(r.Context())
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 2*maxMessageDataSize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxBytesErr):
+				s.contentTooLarge(w, r)
+			default:
+				s.badRequest(w, r, err)
+			}
+			return
+		}
+
+		var input CreateMessageRequest
+		err = json.Unmarshal(body, &input)
+		if err != nil {
+			s.badRequest(w, r, err)
+			return
+		}
+
+		input.Type = strings.TrimSpace(input.Type)
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			key = input.EventID
+		}
+
+		input.Check(validator.NotBlank(input.Type), "type", "Must be provided")
+		input.Check(validator.MaxLength(input.Type, 255), "type", "Must have at most 255 characters")
+		input.Check(validator.Matches(input.Type, eventTypeRx), "type", "Must be dot separated words of letters, digits, '_' or '-'")
+		input.Check(len(input.Data) > 0, "data", "Must be provided")
+		input.Check(bytes.HasPrefix(bytes.TrimSpace(input.Data), []byte("{")), "data", "Must be a JSON object")
+		input.Check(len(input.Data) <= maxMessageDataSize, "data", "Must have at most 256KiB")
+		input.Check(len(input.Tags) <= maxMessageTags, "tags", "Must have at most 10 tags")
+		for _, tag := range input.Tags {
+			input.Check(validator.NotBlank(tag), "tags", "Must not contain blank tags")
+			input.Check(validator.MaxLength(tag, 128), "tags", "Tags must have at most 128 characters")
+		}
+		input.Check(input.EventID == "" || input.EventID == key, "event_id", "Must match the Idempotency-Key header")
+		input.Check(validator.MaxLength(key, 255), "event_id", "Must have at most 255 characters")
+		if !input.IsValid() {
+			s.validationError(w, r, input.FieldErrors)
+			return
+		}
+
+		version, err := s.checkMessageData(r.Context(), &input.Validator, input.Type, input.Version, input.Data)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+		if !input.IsValid() {
+			s.validationError(w, r, input.FieldErrors)
+			return
+		}
+
+		hash, err := requestHash(&input, key)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+		msg := &database.Message{
+			Type:           input.Type,
+			Version:        version,
+			Data:           input.Data,
+			Tags:           input.Tags,
+			SubscriberID:   sub.ID,
+			IdempotencyKey: key,
+			RequestHash:    hash,
+		}
+
+		var cutoff time.Time
+		if key != "" {
+			cutoff = time.Now().Add(-s.cfg.IdempotencyRetention)
+
+			original, err := s.appStore(r.Context()).GetMessageByIdempotencyKey(r.Context(), sub.ID, key)
+			switch {
+			case err == nil && original.CreatedAt.After(cutoff):
+				s.replayMessage(w, r, original, msg.RequestHash)
+				return
+			case err != nil && !errors.Is(err, database.ErrNotFound):
+				s.serverError(w, r, err)
+				return
+			}
+		}
+
+		var endpoints []*database.Endpoint
+		err = s.appStore(r.Context()).InTx(r.Context(), func(ctx context.Context, store *database.Store) error {
+			if key != "" {
+				if err := store.ReleaseIdempotencyKey(ctx, sub.ID, key, cutoff); err != nil {
+					return err
+				}
+			}
+			if err := store.SaveMessage(ctx, msg); err != nil {
+				return err
+			}
+
+			var err error
+			endpoints, err = store.EnqueueMessage(ctx, msg)
+			return err
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrConflict):
+				// A concurrent request with the same key won the race.
+				original, err := s.appStore(r.Context()).GetMessageByIdempotencyKey(r.Context(), sub.ID, key)
+				if err != nil {
+					s.serverError(w, r, err)
+					return
+				}
+				s.replayMessage(w, r, original, msg.RequestHash)
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		s.writeMessageCreated(w, r, msg, endpoints)
+	}
+}
+
+// Hashes a canonical form of the request, so retries that only differ in
+// formatting or key order are still recognized as the same request.
+func requestHash(input *CreateMessageRequest, eventID string) (string, error) {
+	// Decoding into any sorts object keys once encoded again, numbers are
+	// kept as written.
+	dec := json.NewDecoder(bytes.NewReader(input.Data))
+	dec.UseNumber()
+	var data any
+	err := dec.Decode(&data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode message data: %w", err)
+	}
+	tags := input.Tags
+	if len(tags) == 0 {
+		tags = nil
+	}
+
+	canonical, err := json.Marshal(struct {
+		Type    string   `json:"type"`
+		Version int      `json:"version"`
+		Data    any      `json:"data"`
+		Tags    []string `json:"tags"`
+		EventID string   `json:"event_id"`
+	}{
+		Type:    input.Type,
+		Version: input.Version,
+		Data:    data,
+		Tags:    tags,
+		EventID: eventID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	hash := sha256.Sum256(canonical)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// Responds with the message originally created with an idempotency key, as
+// long as the request matches the original one.
+func (s *Server) replayMessage(w http.ResponseWriter, r *http.Request, msg *database.Message, requestHash string) {
+	if msg.RequestHash != requestHash {
+		s.conflict(w, r, "Idempotency key already used with a different request")
+		return
+	}
+
+	endpoints, err := s.appStore(r.Context()).ListMessageEndpoints(r.Context(), msg.ID)
+	if err != nil {
+		s.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Idempotent-Replayed", "true")
+	s.writeMessageCreated(w, r, msg, endpoints)
+}
+
+func (s *Server) writeMessageCreated(w http.ResponseWriter, r *http.Request, msg *database.Message, endpoints []*database.Endpoint) {
+	res := CreateMessageResponse{
+		Message:   mapMessage(msg),
+		Endpoints: make([]*Endpoint, 0, len(endpoints)),
+	}
+	for _, endpoint := range endpoints {
+		res.Endpoints = append(res.Endpoints, mapEndpoint(endpoint))
+	}
+	s.writeJSON(w, r, http.StatusCreated, res)
+}
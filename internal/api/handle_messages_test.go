@@ -0,0 +1,558 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/auth"
+	"github.com/ffss92/webhookd/internal/config"
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestHandleMessageAttemptList(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	sub := &database.Subscriber{
+		Name: "test",
+	}
+	err := api.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &database.Endpoint{
+		Label:        "test",
+		URL:          "http://test.com",
+		SubscriberID: sub.ID,
+	}
+	err = api.store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &database.Message{
+		Type:         "test.created",
+		Data:         json.RawMessage(`{}`),
+		SubscriberID: sub.ID,
+	}
+	err = api.store.SaveMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempt := &database.Attempt{
+		MessageID:  msg.ID,
+		EndpointID: endpoint.ID,
+		StatusCode: http.StatusOK,
+	}
+	err = api.store.SaveAttempt(t.Context(), attempt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		msgID    string
+		expected []*Attempt
+		status   int
+	}{
+		{
+			name:     "valid id",
+			msgID:    msg.ID.String(),
+			expected: []*Attempt{mapAttempt(attempt)},
+			status:   http.StatusOK,
+		},
+		{
+			name:   "non existing id",
+			msgID:  uuid.NewString(),
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "invalid id",
+			msgID:  "foo",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			path := fmt.Sprintf("/api/v1/messages/%s/attempts", tt.msgID)
+			req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := authClient(t, srv, api.store, auth.ScopeAdmin)
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+
+			if tt.status == http.StatusOK {
+				var got []*Attempt
+				err := json.NewDecoder(res.Body).Decode(&got)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if diff := cmp.Diff(tt.expected, got); diff != "" {
+					t.Fatalf("mismatch (-want, +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleSubscriberMessageCreate(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	sub := &database.Subscriber{
+		Name: "test",
+	}
+	err := api.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveEventTypes(t, api.store, "test.created", "test.updated", "test.deleted")
+	typed := &database.EventType{
+		Name:   "test.typed",
+		Schema: json.RawMessage(`{"type": "object", "required": ["id"], "properties": {"id": {"type": "string"}}}`),
+	}
+	err = api.store.SaveEventType(t.Context(), typed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versioned := &database.EventType{Name: "test.versioned", Schema: typed.Schema}
+	err = api.store.SaveEventType(t.Context(), versioned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = api.store.SaveEventTypeVersion(t.Context(), versioned, &database.EventTypeVersion{
+		Schema: json.RawMessage(`{"type": "object", "required": ["ref"]}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints := []*database.Endpoint{
+		{
+			Label:        "match",
+			URL:          "http://match.com",
+			SubscriberID: sub.ID,
+			FilterTypes:  []string{"test.created"},
+		},
+		{
+			Label:        "other type",
+			URL:          "http://other.com",
+			SubscriberID: sub.ID,
+			FilterTypes:  []string{"test.deleted"},
+		},
+	}
+	for _, endpoint := range endpoints {
+		err = api.store.SaveEndpoint(t.Context(), endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name      string
+		subID     string
+		req       *CreateMessageRequest
+		status    int
+		endpoints []uuid.UUID
+	}{
+		{
+			name:  "valid request",
+			subID: sub.ID.String(),
+			req: &CreateMessageRequest{
+				Type: "test.created",
+				Data: json.RawMessage(`{"key":"value"}`),
+				Tags: []string{"foo"},
+			},
+			status:    http.StatusCreated,
+			endpoints: []uuid.UUID{endpoints[0].ID},
+		},
+		{
+			name:  "valid request (no endpoints)",
+			subID: sub.ID.String(),
+			req: &CreateMessageRequest{
+				Type: "test.updated",
+				Data: json.RawMessage(`{}`),
+			},
+			status:    http.StatusCreated,
+			endpoints: []uuid.UUID{},
+		},
+		{
+			name:  "invalid type",
+			subID: sub.ID.String(),
+			req: &CreateMessageRequest{
+				Type: "test..created",
+				Data: json.RawMessage(`{}`),
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:  "unregistered type",
+			subID: sub.ID.String(),
+			req: &CreateMessageRequest{
+				Type: "test.unknown",
+				Data: json.RawMessage(`{}`),
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:  "valid schema data",
+			subID: sub.ID.String(),
+			req: &CreateMessageRequest{
+				Type: "test.typed",
+				Data: json.RawMessage(`{"id":"inv_1"}`),
+			},
+			status:    http.StatusCreated,
+			endpoints: []uuid.UUID{},
+		},
+		{
+			name:  "invalid schema data",
+			subID: sub.ID.String(),
+			req: &CreateMessageRequest{
+				Type: "test.typed",
+				Data: json.RawMessage(`{"id":1}`),
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:  "previous version",
+			subID: sub.ID.String(),
+			req: &CreateMessageRequest{
+				Type:    "test.versioned",
+				Version: 1,
+				Data:    json.RawMessage(`{"id":"inv_1"}`),
+			},
+			status:    http.StatusCreated,
+			endpoints: []uuid.UUID{},
+		},
+		{
+			name:  "current version",
+			subID: sub.ID.String(),
+			req: &CreateMessageRequest{
+				Type: "test.versioned",
+				Data: json.RawMessage(`{"id":"inv_1"}`),
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:  "unknown version",
+			subID: sub.ID.String(),
+			req: &CreateMessageRequest{
+				Type:    "test.versioned",
+				Version: 3,
+				Data:    json.RawMessage(`{"ref":"inv_1"}`),
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:  "non object data",
+			subID: sub.ID.String(),
+			req: &CreateMessageRequest{
+				Type: "test.created",
+				Data: json.RawMessage(`[1, 2]`),
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:  "data too large",
+			subID: sub.ID.String(),
+			req: &CreateMessageRequest{
+				Type: "test.created",
+				Data: json.RawMessage(`{"key":"` + strings.Repeat("a", maxMessageDataSize) + `"}`),
+			},
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:  "body too large",
+			subID: sub.ID.String(),
+			req: &CreateMessageRequest{
+				Type: "test.created",
+				Data: json.RawMessage(`{"key":"` + strings.Repeat("a", 2*maxMessageDataSize) + `"}`),
+			},
+			status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:   "missing body",
+			subID:  sub.ID.String(),
+			req:    nil,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:  "non existing subscriber",
+			subID: uuid.NewString(),
+			req: &CreateMessageRequest{
+				Type: "test.created",
+				Data: json.RawMessage(`{}`),
+			},
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := fmt.Sprintf("/api/v1/subscribers/%s/messages", tt.subID)
+			req, err := http.NewRequest(http.MethodPost, srv.URL+path, bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := authClient(t, srv, api.store, auth.ScopeAdmin)
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+
+			if res.StatusCode == http.StatusCreated {
+				var got CreateMessageResponse
+				err := json.NewDecoder(res.Body).Decode(&got)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				gotIDs := make([]uuid.UUID, 0, len(got.Endpoints))
+				for _, endpoint := range got.Endpoints {
+					gotIDs = append(gotIDs, endpoint.ID)
+				}
+				if diff := cmp.Diff(tt.endpoints, gotIDs); diff != "" {
+					t.Fatalf("endpoints mismatch (-want, +got):\n%s", diff)
+				}
+
+				for _, endpointID := range tt.endpoints {
+					_, err := api.store.GetDelivery(t.Context(), got.Message.ID, endpointID)
+					if err != nil {
+						t.Fatalf("expected delivery to be queued: %v", err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHandleSubscriberMessageCreate_Idempotency(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		cfg: &config.Config{
+			IdempotencyRetention: time.Hour,
+		},
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	sub := &database.Subscriber{
+		Name: "test",
+	}
+	err := api.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &database.Endpoint{
+		Label:        "test",
+		URL:          "http://test.com",
+		SubscriberID: sub.ID,
+	}
+	err = api.store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saveEventTypes(t, api.store, "test.created", "test.deleted")
+
+	path := fmt.Sprintf("/api/v1/subscribers/%s/messages", sub.ID)
+	send := func(key string, body string) (*http.Response, *CreateMessageResponse) {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+
+		res, err := authClient(t, srv, api.store, auth.ScopeAdmin).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusCreated {
+			return res, nil
+		}
+		var got CreateMessageResponse
+		if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		return res, &got
+	}
+
+	body := `{"type":"test.created","data":{"key":"value"}}`
+
+	res, original := send("key-1", body)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status %d but got %d", http.StatusCreated, res.StatusCode)
+	}
+
+	res, replayed := send("key-1", body)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected replay status %d but got %d", http.StatusCreated, res.StatusCode)
+	}
+	if replayed.Message.ID != original.Message.ID {
+		t.Fatal("expected replay to return the original message")
+	}
+	if len(replayed.Endpoints) != 1 || replayed.Endpoints[0].ID != endpoint.ID {
+		t.Fatalf("expected replay to return the original endpoints but got %+v", replayed.Endpoints)
+	}
+
+	res, reformatted := send("key-1", `{"data": {"key": "value"}, "tags": [], "type": "test.created"}`)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected replay status %d but got %d", http.StatusCreated, res.StatusCode)
+	}
+	if reformatted.Message.ID != original.Message.ID {
+		t.Fatal("expected reformatted replay to return the original message")
+	}
+
+	res, _ = send("key-1", `{"type":"test.deleted","data":{"key":"value"}}`)
+	if res.StatusCode != http.StatusConflict {
+		t.Fatalf("expected status %d but got %d", http.StatusConflict, res.StatusCode)
+	}
+
+	res, fromBody := send("", `{"type":"test.created","data":{},"event_id":"key-2"}`)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status %d but got %d", http.StatusCreated, res.StatusCode)
+	}
+	if fromBody.Message.EventID != "key-2" {
+		t.Fatalf("expected event_id to be %q but got %q", "key-2", fromBody.Message.EventID)
+	}
+
+	res, _ = send("key-3", `{"type":"test.created","data":{},"event_id":"key-2"}`)
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status %d but got %d", http.StatusUnprocessableEntity, res.StatusCode)
+	}
+
+	res, unkeyed := send("", body)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status %d but got %d", http.StatusCreated, res.StatusCode)
+	}
+	if unkeyed.Message.ID == original.Message.ID {
+		t.Fatal("expected request without key to create a new message")
+	}
+}
+
+func TestHandleSubscriberMessageCreate_IdempotencyExpired(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		cfg: &config.Config{
+			IdempotencyRetention: time.Hour,
+		},
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	sub := &database.Subscriber{
+		Name: "test",
+	}
+	err := api.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saveEventTypes(t, api.store, "test.created")
+
+	expired := &database.Message{
+		Type:           "test.created",
+		Data:           json.RawMessage(`{}`),
+		SubscriberID:   sub.ID,
+		IdempotencyKey: "key-1",
+	}
+	err = api.store.SaveMessage(t.Context(), expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = pool.Exec(t.Context(), "UPDATE messages SET created_at = created_at - INTERVAL '2 hours' WHERE id = $1", expired.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := fmt.Sprintf("/api/v1/subscribers/%s/messages", sub.ID)
+	req, err := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(`{"type":"test.created","data":{}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Idempotency-Key", "key-1")
+
+	res, err := authClient(t, srv, api.store, auth.ScopeAdmin).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status %d but got %d", http.StatusCreated, res.StatusCode)
+	}
+
+	var got CreateMessageResponse
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Message.ID == expired.ID {
+		t.Fatal("expected expired key to create a new message")
+	}
+}
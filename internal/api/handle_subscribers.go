@@ -1,12 +1,16 @@
 package api
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ffss92/webhookd/internal/auth"
 	"github.com/ffss92/webhookd/internal/database"
 	"github.com/ffss92/webhookd/internal/validator"
 	"github.com/google/uuid"
@@ -14,6 +18,7 @@ import (
 
 type Subscriber struct {
 	ID        uuid.UUID      `json:"id"`
+	UID       *string        `json:"uid"`
 	Name      string         `json:"name"`
 	Metadata  map[string]any `json:"metadata"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -29,22 +34,122 @@ func mapSubscriber(record *database.Subscriber) (*Subscriber, error) {
 
 	return &Subscriber{
 		ID:        record.ID,
+		UID:       nullString(record.UID),
 		Name:      record.Name,
 		Metadata:  metadata,
 		CreatedAt: record.CreatedAt,
-		UpdatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
 	}, nil
 }
 
+// Cursors are opaque to clients, they encode the creation time in
+// microseconds and the id of the last subscriber of a page.
+func encodeSubscriberCursor(cursor database.SubscriberCursor) string {
+	raw := fmt.Sprintf("%d:%s", cursor.CreatedAt.UnixMicro(), cursor.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSubscriberCursor(s string) (*database.SubscriberCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	micros, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	createdAt, err := strconv.ParseInt(micros, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	subID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	return &database.SubscriberCursor{
+		CreatedAt: time.UnixMicro(createdAt),
+		ID:        subID,
+	}, nil
+}
+
+// Lists subscribers ordered by creation. Supports the "name" prefix and the
+// "metadata" JSON object, which the subscriber metadata must contain, as
+// filters.
+func (s *Server) handleSubscriberList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		limit := limitParam(r)
+
+		var v validator.Validator
+		params := database.ListSubscribersParams{
+			NamePrefix:   query.Get("name"),
+			SubscriberID: getAPIKey(r.Context()).SubscriberID,
+			// One more to know if there is a next page.
+			Limit: limit + 1,
+		}
+		if cursor := query.Get("cursor"); cursor != "" {
+			after, err := decodeSubscriberCursor(cursor)
+			v.Check(err == nil, "cursor", "Must be a cursor returned by a previous page")
+			params.After = after
+		}
+		if metadata := query.Get("metadata"); metadata != "" {
+			var filter map[string]any
+			err := json.Unmarshal([]byte(metadata), &filter)
+			v.Check(err == nil && filter != nil, "metadata", "Must be a JSON object")
+			params.Metadata = json.RawMessage(metadata)
+		}
+		if !v.IsValid() {
+			s.validationError(w, r, v.FieldErrors)
+			return
+		}
+
+		subscribers, err := s.appStore(r.Context()).ListSubscribers(r.Context(), params)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+
+		res := ListResponse[*Subscriber]{
+			Data:    make([]*Subscriber, 0, min(len(subscribers), limit)),
+			HasMore: len(subscribers) > limit,
+		}
+		for _, record := range subscribers[:min(len(subscribers), limit)] {
+			sub, err := mapSubscriber(record)
+			if err != nil {
+				s.serverError(w, r, err)
+				return
+			}
+			res.Data = append(res.Data, sub)
+		}
+		if res.HasMore {
+			last := subscribers[limit-1]
+			cursor := encodeSubscriberCursor(database.SubscriberCursor{
+				CreatedAt: last.CreatedAt,
+				ID:        last.ID,
+			})
+			res.NextCursor = &cursor
+		}
+
+		s.writeJSON(w, r, http.StatusOK, res)
+	}
+}
+
 type CreateSubscriberRequest struct {
 	Name     string         `json:"name"`
 	Metadata map[string]any `json:"metadata"`
+	UID      string         `json:"uid"`
 
 	validator.Validator `json:"-"`
 }
 
 func (s *Server) handleSubscriberCreate() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// Keys bound to a subscriber can't create other subscribers.
+		if getAPIKey(r.Context()).SubscriberID != nil {
+			s.forbidden(w, r)
+			return
+		}
+
 		var input CreateSubscriberRequest
 		err := json.NewDecoder(r.Body).Decode(&input)
 		if err != nil {
@@ -59,6 +164,7 @@ func (s *Server) handleSubscriberCreate() http.HandlerFunc {
 
 		input.Check(validator.NotBlank(input.Name), "name", "Must be provided")
 		input.Check(validator.MaxLength(input.Name, 255), "name", "Must have at most 255 characters")
+		checkUID(&input.Validator, input.UID)
 		if !input.IsValid() {
 			s.validationError(w, r, input.FieldErrors)
 			return
@@ -71,13 +177,19 @@ func (s *Server) handleSubscriberCreate() http.HandlerFunc {
 		}
 
 		sub := &database.Subscriber{
+			UID:      input.UID,
 			Name:     input.Name,
 			Metadata: metadata,
 		}
 
-		err = s.store.SaveSubscriber(r.Context(), sub)
+		err = s.appStore(r.Context()).SaveSubscriber(r.Context(), sub)
 		if err != nil {
-			s.serverError(w, r, err)
+			switch {
+			case errors.Is(err, database.ErrConflict):
+				s.conflict(w, r, "Subscriber uid is already in use")
+			default:
+				s.serverError(w, r, err)
+			}
 			return
 		}
 
@@ -91,6 +203,116 @@ func (s *Server) handleSubscriberCreate() http.HandlerFunc {
 	}
 }
 
+const (
+	metadataMerge   = "merge"
+	metadataReplace = "replace"
+)
+
+// Applies patch to target following JSON merge patch (RFC 7386), where null
+// values remove keys and nested objects are merged recursively.
+func mergeMetadata(target, patch map[string]any) map[string]any {
+	merged := make(map[string]any, len(target)+len(patch))
+	for key, value := range target {
+		merged[key] = value
+	}
+	for key, value := range patch {
+		switch value := value.(type) {
+		case nil:
+			delete(merged, key)
+		case map[string]any:
+			nested, _ := merged[key].(map[string]any)
+			merged[key] = mergeMetadata(nested, value)
+		default:
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+type UpdateSubscriberRequest struct {
+	Name     Optional[string]         `json:"name"`
+	Metadata Optional[map[string]any] `json:"metadata"`
+	// Either "merge", the default, or "replace".
+	MetadataMode string           `json:"metadata_mode"`
+	UID          Optional[string] `json:"uid"`
+
+	validator.Validator `json:"-"`
+}
+
+func (s *Server) handleSubscriberUpdate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var input UpdateSubscriberRequest
+		err := json.NewDecoder(r.Body).Decode(&input)
+		if err != nil {
+			s.badRequest(w, r, err)
+			return
+		}
+
+		input.Name.Value = strings.TrimSpace(input.Name.Value)
+		if input.MetadataMode == "" {
+			input.MetadataMode = metadataMerge
+		}
+
+		input.Check(!input.Name.Null, "name", "Must not be null")
+		if input.Name.Set {
+			input.Check(validator.NotBlank(input.Name.Value), "name", "Must be provided")
+			input.Check(validator.MaxLength(input.Name.Value, 255), "name", "Must have at most 255 characters")
+		}
+		input.Check(!input.Metadata.Null, "metadata", "Must not be null")
+		input.Check(validator.PermittedValue(input.MetadataMode, metadataMerge, metadataReplace), "metadata_mode", "Must be either merge or replace")
+		checkUID(&input.Validator, input.UID.Value)
+		if !input.IsValid() {
+			s.validationError(w, r, input.FieldErrors)
+			return
+		}
+
+		sub := getSubscriber(r.Context())
+		if input.Name.Set {
+			sub.Name = input.Name.Value
+		}
+		if input.UID.Set {
+			sub.UID = input.UID.Value
+		}
+		if input.Metadata.Set {
+			metadata := input.Metadata.Value
+			if input.MetadataMode == metadataMerge {
+				var current map[string]any
+				err := json.Unmarshal(sub.Metadata, &current)
+				if err != nil {
+					s.serverError(w, r, err)
+					return
+				}
+				metadata = mergeMetadata(current, metadata)
+			}
+
+			sub.Metadata, err = json.Marshal(metadata)
+			if err != nil {
+				s.serverError(w, r, err)
+				return
+			}
+		}
+
+		err = s.appStore(r.Context()).UpdateSubscriber(r.Context(), sub)
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrConflict):
+				s.conflict(w, r, "Subscriber uid is already in use")
+			default:
+				s.serverError(w, r, err)
+			}
+			return
+		}
+
+		res, err := mapSubscriber(sub)
+		if err != nil {
+			s.serverError(w, r, err)
+			return
+		}
+
+		s.writeJSON(w, r, http.StatusOK, res)
+	}
+}
+
 func (s *Server) handleSubscriberDetail() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		sub := getSubscriber(r.Context())
@@ -107,7 +329,7 @@ func (s *Server) handleSubscriberDetail() http.HandlerFunc {
 func (s *Server) handleSubscriberDelete() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		sub := getSubscriber(r.Context())
-		err := s.store.DeleteSubscriber(r.Context(), sub.ID)
+		err := s.appStore(r.Context()).DeleteSubscriber(r.Context(), sub.ID)
 		if err != nil {
 			s.serverError(w, r, err)
 			return
@@ -131,7 +353,7 @@ func (s *Server) handleSubscriberEndpointList() http.HandlerFunc {
 			}
 		}
 
-		endpoints, err := s.store.ListEndpoints(r.Context(), params)
+		endpoints, err := s.appStore(r.Context()).ListEndpoints(r.Context(), params)
 		if err != nil {
 			s.serverError(w, r, err)
 			return
@@ -144,3 +366,27 @@ func (s *Server) handleSubscriberEndpointList() http.HandlerFunc {
 		s.writeJSON(w, r, http.StatusOK, res)
 	}
 }
+
+type PortalToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Issues a short-lived token that lets the subscriber manage its endpoints
+// and retry deliveries, to be used from the browser by embedded portals.
+func (s *Server) handleSubscriberPortalToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := s.cfg.PortalKey()
+		if key == nil {
+			s.notFound(w, r)
+			return
+		}
+
+		sub := getSubscriber(r.Context())
+		expiresAt := time.Now().Add(s.cfg.PortalTokenTTL).Truncate(time.Second)
+		s.writeJSON(w, r, http.StatusCreated, PortalToken{
+			Token:     auth.SignPortalToken(key, sub.ApplicationID, sub.ID, expiresAt),
+			ExpiresAt: expiresAt,
+		})
+	}
+}
@@ -2,14 +2,19 @@ package api
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
+	"github.com/ffss92/webhookd/internal/auth"
+	"github.com/ffss92/webhookd/internal/config"
 	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/webhook"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
 )
@@ -59,7 +64,7 @@ func TestHandleSubscriberCreate(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			client := srv.Client()
+			client := authClient(t, srv, api.store, auth.ScopeAdmin)
 
 			req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/subscribers", bytes.NewReader(b))
 			if err != nil {
@@ -100,6 +105,7 @@ func TestHandleSubscriberDetail(t *testing.T) {
 
 	sub := &database.Subscriber{
 		Name: "test",
+		UID:  "cust_123",
 	}
 	err := api.store.SaveSubscriber(t.Context(), sub)
 	if err != nil {
@@ -109,28 +115,44 @@ func TestHandleSubscriberDetail(t *testing.T) {
 	testCases := []struct {
 		name   string
 		subID  string
+		scope  string
 		status int
 	}{
 		{
 			name:   "valid id",
 			subID:  sub.ID.String(),
+			scope:  auth.ScopeAdmin,
+			status: http.StatusOK,
+		},
+		{
+			name:   "valid uid",
+			subID:  sub.UID,
+			scope:  auth.ScopeAdmin,
 			status: http.StatusOK,
 		},
 		{
 			name:   "non existing id",
 			subID:  uuid.NewString(),
+			scope:  auth.ScopeAdmin,
 			status: http.StatusNotFound,
 		},
 		{
 			name:   "invalid id",
 			subID:  "foo",
+			scope:  auth.ScopeAdmin,
 			status: http.StatusNotFound,
 		},
+		{
+			name:   "missing scope (non existing id)",
+			subID:  uuid.NewString(),
+			scope:  auth.ScopeEndpointsRead,
+			status: http.StatusForbidden,
+		},
 	}
 
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
-			client := srv.Client()
+			client := authClient(t, srv, api.store, tt.scope)
 
 			path := fmt.Sprintf("/api/v1/subscribers/%s", tt.subID)
 			req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
@@ -148,11 +170,14 @@ func TestHandleSubscriberDetail(t *testing.T) {
 				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
 			}
 			if res.StatusCode == http.StatusOK {
-				var sub Subscriber
-				err := json.NewDecoder(res.Body).Decode(&sub)
+				var got Subscriber
+				err := json.NewDecoder(res.Body).Decode(&got)
 				if err != nil {
 					t.Fatal(err)
 				}
+				if got.ID != sub.ID {
+					t.Fatalf("expected subscriber %s but got %s", sub.ID, got.ID)
+				}
 			}
 		})
 	}
@@ -197,7 +222,7 @@ func TestHandleSubscriberDelete(t *testing.T) {
 
 	for _, tt := range testCases {
 		t.Run(tt.name, func(t *testing.T) {
-			client := srv.Client()
+			client := authClient(t, srv, api.store, auth.ScopeAdmin)
 
 			path := fmt.Sprintf("/api/v1/subscribers/%s", tt.subID)
 			req, err := http.NewRequest(http.MethodDelete, srv.URL+path, nil)
@@ -303,7 +328,7 @@ func TestHandleSubscriberEndpointList(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			client := srv.Client()
+			client := authClient(t, srv, api.store, auth.ScopeAdmin)
 			res, err := client.Do(req)
 			if err != nil {
 				t.Fatal(err)
@@ -328,3 +353,313 @@ func TestHandleSubscriberEndpointList(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleSubscriberPortalToken(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		cfg: &config.Config{
+			PortalSigningKey: base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)),
+			PortalTokenTTL:   time.Hour,
+		},
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	subs := make([]*database.Subscriber, 2)
+	endpoints := make([]*database.Endpoint, 2)
+	for i := range subs {
+		subs[i] = &database.Subscriber{Name: fmt.Sprintf("test-%d", i)}
+		err := api.store.SaveSubscriber(t.Context(), subs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		endpoints[i] = &database.Endpoint{
+			Label:        "test",
+			URL:          "https://test.com/webhooks",
+			Secret:       webhook.NewSecret(),
+			SubscriberID: subs[i].ID,
+		}
+		err = api.store.SaveEndpoint(t.Context(), endpoints[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := fmt.Sprintf("%s/api/v1/subscribers/%s/portal-token", srv.URL, subs[0].ID)
+	req, err := http.NewRequest(http.MethodPost, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := authClient(t, srv, api.store, auth.ScopePortalWrite).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status %d but got %d", http.StatusCreated, res.StatusCode)
+	}
+
+	var token PortalToken
+	err = json.NewDecoder(res.Body).Decode(&token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired := auth.SignPortalToken(api.cfg.PortalKey(), subs[0].ApplicationID, subs[0].ID, time.Now().Add(-time.Minute))
+
+	testCases := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		status int
+	}{
+		{
+			name:   "own endpoint",
+			token:  token.Token,
+			method: http.MethodGet,
+			path:   "/api/v1/endpoints/" + endpoints[0].ID.String(),
+			status: http.StatusOK,
+		},
+		{
+			name:   "other endpoint",
+			token:  token.Token,
+			method: http.MethodGet,
+			path:   "/api/v1/endpoints/" + endpoints[1].ID.String(),
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "endpoint secret",
+			token:  token.Token,
+			method: http.MethodGet,
+			path:   fmt.Sprintf("/api/v1/endpoints/%s/secret", endpoints[0].ID),
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "issue another token",
+			token:  token.Token,
+			method: http.MethodPost,
+			path:   fmt.Sprintf("/api/v1/subscribers/%s/portal-token", subs[0].ID),
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "expired token",
+			token:  expired,
+			method: http.MethodGet,
+			path:   "/api/v1/endpoints/" + endpoints[0].ID.String(),
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			res, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHandleSubscriberList(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	for i, plan := range []string{"pro", "free", "pro"} {
+		err := api.store.SaveSubscriber(t.Context(), &database.Subscriber{
+			Name:     fmt.Sprintf("test-%d", i),
+			Metadata: json.RawMessage(fmt.Sprintf(`{"plan": %q}`, plan)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(t *testing.T, query url.Values) (*http.Response, ListResponse[*Subscriber]) {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/subscribers?"+query.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := authClient(t, srv, api.store, auth.ScopeSubscribersRead).Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		var page ListResponse[*Subscriber]
+		if res.StatusCode == http.StatusOK {
+			err := json.NewDecoder(res.Body).Decode(&page)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return res, page
+	}
+
+	names := func(subscribers []*Subscriber) []string {
+		names := make([]string, 0, len(subscribers))
+		for _, sub := range subscribers {
+			names = append(names, sub.Name)
+		}
+		return names
+	}
+
+	_, first := list(t, url.Values{"limit": {"2"}})
+	if diff := cmp.Diff([]string{"test-0", "test-1"}, names(first.Data)); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+	if !first.HasMore || first.NextCursor == nil {
+		t.Fatal("expected first page to have more results")
+	}
+
+	_, second := list(t, url.Values{"limit": {"2"}, "cursor": {*first.NextCursor}})
+	if diff := cmp.Diff([]string{"test-2"}, names(second.Data)); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+	if second.HasMore || second.NextCursor != nil {
+		t.Fatal("expected second page to be the last")
+	}
+
+	_, filtered := list(t, url.Values{"metadata": {`{"plan": "pro"}`}})
+	if diff := cmp.Diff([]string{"test-0", "test-2"}, names(filtered.Data)); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	for _, query := range []url.Values{{"cursor": {"invalid"}}, {"metadata": {"[]"}}} {
+		res, _ := list(t, query)
+		if res.StatusCode != http.StatusUnprocessableEntity {
+			t.Fatalf("expected status %d but got %d", http.StatusUnprocessableEntity, res.StatusCode)
+		}
+	}
+}
+
+func TestHandleSubscriberUpdate(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	api := &Server{
+		pool:  pool,
+		store: database.New(pool),
+	}
+
+	srv := httptest.NewServer(api.Routes())
+	defer srv.Close()
+
+	testCases := []struct {
+		name     string
+		body     string
+		status   int
+		wantName string
+		wantMeta map[string]any
+	}{
+		{
+			name:     "rename",
+			body:     `{"name": "renamed"}`,
+			status:   http.StatusOK,
+			wantName: "renamed",
+			wantMeta: map[string]any{"plan": "pro", "owner": map[string]any{"name": "jane", "team": "a"}},
+		},
+		{
+			name:     "merge metadata",
+			body:     `{"metadata": {"plan": null, "region": "eu", "owner": {"team": "b"}}}`,
+			status:   http.StatusOK,
+			wantName: "test",
+			wantMeta: map[string]any{"region": "eu", "owner": map[string]any{"name": "jane", "team": "b"}},
+		},
+		{
+			name:     "replace metadata",
+			body:     `{"metadata": {"region": "eu"}, "metadata_mode": "replace"}`,
+			status:   http.StatusOK,
+			wantName: "test",
+			wantMeta: map[string]any{"region": "eu"},
+		},
+		{
+			name:   "invalid mode",
+			body:   `{"metadata": {}, "metadata_mode": "append"}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "blank name",
+			body:   `{"name": " "}`,
+			status: http.StatusUnprocessableEntity,
+		},
+		{
+			name:   "null metadata",
+			body:   `{"metadata": null}`,
+			status: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := &database.Subscriber{
+				Name:     "test",
+				Metadata: json.RawMessage(`{"plan": "pro", "owner": {"name": "jane", "team": "a"}}`),
+			}
+			err := api.store.SaveSubscriber(t.Context(), sub)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := fmt.Sprintf("%s/api/v1/subscribers/%s", srv.URL, sub.ID)
+			req, err := http.NewRequest(http.MethodPatch, path, bytes.NewReader([]byte(tt.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client := authClient(t, srv, api.store, auth.ScopeSubscribersWrite)
+			res, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+
+			if res.StatusCode == http.StatusOK {
+				var got Subscriber
+				err := json.NewDecoder(res.Body).Decode(&got)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Name != tt.wantName {
+					t.Fatalf("expected name %q but got %q", tt.wantName, got.Name)
+				}
+				if diff := cmp.Diff(tt.wantMeta, got.Metadata); diff != "" {
+					t.Fatalf("mismatch (-want, +got):\n%s", diff)
+				}
+				if !got.UpdatedAt.After(got.CreatedAt) {
+					t.Fatal("expected updated_at to be after created_at")
+				}
+			}
+		})
+	}
+}
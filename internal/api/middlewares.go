@@ -4,16 +4,124 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/ffss92/webhookd/internal/auth"
 	"github.com/ffss92/webhookd/internal/database"
+	"github.com/google/uuid"
 )
 
 const (
 	subscriberKey contextKey = iota
+	apiKeyKey
 )
 
 type contextKey int
 
+func getAPIKey(ctx context.Context) *database.APIKey {
+	key, ok := ctx.Value(apiKeyKey).(*database.APIKey)
+	if !ok {
+		panic("api key not present in context")
+	}
+	return key
+}
+
+// Returns the store restricted to the application of the authenticated API
+// key, which keeps applications from touching each other's data.
+func (s *Server) appStore(ctx context.Context) *database.Store {
+	return s.store.ForApplication(getAPIKey(ctx).ApplicationID)
+}
+
+// Reports whether the authenticated API key can access the resources owned
+// by the subscriber. Keys bound to another subscriber must not learn that the
+// resources exist, so callers respond with 404.
+func canAccess(ctx context.Context, subID uuid.UUID) bool {
+	key := getAPIKey(ctx)
+	return key.SubscriberID == nil || *key.SubscriberID == subID
+}
+
+// Authenticates requests with an API key or a portal token sent as a bearer
+// token.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			s.unauthorized(w, r)
+			return
+		}
+
+		var key *database.APIKey
+		switch {
+		case strings.HasPrefix(token, auth.PortalTokenPrefix):
+			key, ok = s.authenticatePortalToken(token)
+			if !ok {
+				s.unauthorized(w, r)
+				return
+			}
+		case strings.HasPrefix(token, auth.KeyPrefix):
+			var err error
+			key, err = s.store.GetAPIKeyByHash(r.Context(), auth.HashKey(token))
+			if err != nil {
+				switch {
+				case errors.Is(err, database.ErrNotFound):
+					s.unauthorized(w, r)
+				default:
+					s.serverError(w, r, err)
+				}
+				return
+			}
+
+			err = s.store.TouchAPIKey(r.Context(), key.ID)
+			if err != nil {
+				s.serverError(w, r, err)
+				return
+			}
+		default:
+			s.unauthorized(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), apiKeyKey, key)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Portal tokens act as a key restricted to their subscriber and to the
+// portal scopes. It is never stored.
+func (s *Server) authenticatePortalToken(token string) (*database.APIKey, bool) {
+	secret := s.cfg.PortalKey()
+	if secret == nil {
+		return nil, false
+	}
+	claims, err := auth.ParsePortalToken(secret, token, time.Now())
+	if err != nil {
+		return nil, false
+	}
+	return &database.APIKey{
+		ApplicationID: claims.ApplicationID,
+		Name:          "portal",
+		Scopes:        auth.PortalScopes,
+		SubscriberID:  &claims.SubscriberID,
+	}, true
+}
+
+// Rejects requests authenticated with an API key missing any of the scopes.
+func (s *Server) requireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := getAPIKey(r.Context())
+			for _, scope := range scopes {
+				if !auth.HasScope(key.Scopes, scope) {
+					s.forbidden(w, r)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func getSubscriber(ctx context.Context) *database.Subscriber {
 	sub, ok := ctx.Value(subscriberKey).(*database.Subscriber)
 	if !ok {
@@ -22,15 +130,20 @@ func getSubscriber(ctx context.Context) *database.Subscriber {
 	return sub
 }
 
+// Gets the subscriber identified by its id or by its uid.
+func (s *Server) lookupSubscriber(ctx context.Context, ref string) (*database.Subscriber, error) {
+	if id, err := uuid.Parse(ref); err == nil {
+		return s.appStore(ctx).GetSubscriber(ctx, id)
+	}
+	return s.appStore(ctx).GetSubscriberByUID(ctx, ref)
+}
+
 func (s *Server) withSubscriber(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		subID, err := uuidParam(r, "subID")
-		if err != nil {
-			s.notFound(w, r)
-			return
+		sub, err := s.lookupSubscriber(r.Context(), r.PathValue("subID"))
+		if err == nil && !canAccess(r.Context(), sub.ID) {
+			err = database.ErrNotFound
 		}
-
-		sub, err := s.store.GetSubscriber(r.Context(), subID)
 		if err != nil {
 			switch {
 			case errors.Is(err, database.ErrNotFound):
@@ -3,27 +3,65 @@ package api
 import (
 	"net/http"
 
+	"github.com/ffss92/webhookd/internal/auth"
 	"github.com/go-chi/chi/v5"
 )
 
 func (s *Server) Routes() http.Handler {
 	r := chi.NewMux()
+	r.Use(s.authenticate)
 
 	r.Route("/api/v1/subscribers", func(r chi.Router) {
-		r.Post("/", s.handleSubscriberCreate())
+		r.With(s.requireScope(auth.ScopeSubscribersRead)).Get("/", s.handleSubscriberList())
+		r.With(s.requireScope(auth.ScopeSubscribersWrite)).Post("/", s.handleSubscriberCreate())
 
 		r.Route("/{subID}", func(r chi.Router) {
-			r.Use(s.withSubscriber)
-			r.Get("/", s.handleSubscriberDetail())
-			r.Delete("/", s.handleSubscriberDelete())
-			r.Get("/endpoints", s.handleSubscriberEndpointList())
+			r.With(s.requireScope(auth.ScopeSubscribersRead), s.withSubscriber).Get("/", s.handleSubscriberDetail())
+			r.With(s.requireScope(auth.ScopeSubscribersWrite), s.withSubscriber).Patch("/", s.handleSubscriberUpdate())
+			r.With(s.requireScope(auth.ScopeSubscribersWrite), s.withSubscriber).Delete("/", s.handleSubscriberDelete())
+			r.With(s.requireScope(auth.ScopeEndpointsRead), s.withSubscriber).Get("/endpoints", s.handleSubscriberEndpointList())
+			r.With(s.requireScope(auth.ScopeMessagesWrite), s.withSubscriber).Post("/messages", s.handleSubscriberMessageCreate())
+			r.With(s.requireScope(auth.ScopePortalWrite), s.withSubscriber).Post("/portal-token", s.handleSubscriberPortalToken())
 		})
 	})
 
 	r.Route("/api/v1/endpoints", func(r chi.Router) {
-		r.Post("/", s.handleEndpointCreate())
-		r.Get("/{endpointID}", s.handleEndpointDetail())
-		r.Delete("/{endpointID}", s.handleEndpointDelete())
+		r.With(s.requireScope(auth.ScopeEndpointsWrite)).Post("/", s.handleEndpointCreate())
+		r.With(s.requireScope(auth.ScopeEndpointsRead)).Get("/{endpointID}", s.handleEndpointDetail())
+		r.With(s.requireScope(auth.ScopeEndpointsWrite)).Patch("/{endpointID}", s.handleEndpointUpdate())
+		r.With(s.requireScope(auth.ScopeEndpointsWrite)).Delete("/{endpointID}", s.handleEndpointDelete())
+		r.With(s.requireScope(auth.ScopeAttemptsRead)).Get("/{endpointID}/attempts", s.handleEndpointAttemptList())
+		r.With(s.requireScope(auth.ScopeAttemptsWrite)).
+			Post("/{endpointID}/messages/{msgID}/retry", s.handleEndpointMessageRetry())
+		r.With(s.requireScope(auth.ScopeSecretsRead)).Get("/{endpointID}/secret", s.handleEndpointSecretDetail())
+		r.With(s.requireScope(auth.ScopeEndpointsWrite, auth.ScopeSecretsRead)).
+			Post("/{endpointID}/secret/rotate", s.handleEndpointSecretRotate())
+	})
+
+	r.Route("/api/v1/messages", func(r chi.Router) {
+		r.With(s.requireScope(auth.ScopeAttemptsRead)).Get("/{msgID}/attempts", s.handleMessageAttemptList())
+	})
+
+	r.Route("/api/v1/event-types", func(r chi.Router) {
+		r.With(s.requireScope(auth.ScopeEventTypesRead)).Get("/", s.handleEventTypeList())
+		r.With(s.requireScope(auth.ScopeEventTypesWrite)).Post("/", s.handleEventTypeCreate())
+		r.With(s.requireScope(auth.ScopeEventTypesRead)).Get("/{name}", s.handleEventTypeDetail())
+		r.With(s.requireScope(auth.ScopeEventTypesWrite)).Patch("/{name}", s.handleEventTypeUpdate())
+		r.With(s.requireScope(auth.ScopeEventTypesWrite)).Delete("/{name}", s.handleEventTypeDelete())
+		r.With(s.requireScope(auth.ScopeEventTypesRead)).Get("/{name}/versions", s.handleEventTypeVersionList())
+		r.With(s.requireScope(auth.ScopeEventTypesWrite)).Post("/{name}/versions", s.handleEventTypeVersionCreate())
+	})
+
+	r.Route("/api/v1/application", func(r chi.Router) {
+		r.Use(s.requireScope(auth.ScopeAdmin))
+		r.Get("/", s.handleApplicationDetail())
+		r.Patch("/", s.handleApplicationUpdate())
+	})
+
+	r.Route("/api/v1/api-keys", func(r chi.Router) {
+		r.Use(s.requireScope(auth.ScopeAdmin))
+		r.Post("/", s.handleAPIKeyCreate())
+		r.Delete("/{keyID}", s.handleAPIKeyDelete())
 	})
 
 	return r
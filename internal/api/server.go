@@ -32,11 +32,16 @@ func NewServer(scfg ServerConfig) (*Server, error) {
 		return nil, fmt.Errorf("missing db pool in server config")
 	}
 
+	kr, err := scfg.Config.Keyring()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keyring: %w", err)
+	}
+
 	return &Server{
 		devMode: scfg.DevMode,
 		logger:  scfg.Logger,
 		cfg:     scfg.Config,
 		pool:    scfg.Pool,
-		store:   database.New(scfg.Pool),
+		store:   database.New(scfg.Pool, database.WithKeyring(kr)),
 	}, nil
 }
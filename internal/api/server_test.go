@@ -2,8 +2,12 @@ package api
 
 import (
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/ffss92/webhookd/internal/auth"
+	"github.com/ffss92/webhookd/internal/database"
 	"github.com/ffss92/webhookd/internal/postgres"
 )
 
@@ -20,3 +24,50 @@ func TestMain(m *testing.M) {
 	}()
 	m.Run()
 }
+
+// Sets the Authorization header on every request.
+type bearerTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(r)
+}
+
+// Returns a client for srv authenticated with a new API key granted scopes.
+func authClient(t *testing.T, srv *httptest.Server, store *database.Store, scopes ...string) *http.Client {
+	t.Helper()
+	return keyClient(t, srv, store, &database.APIKey{Scopes: scopes})
+}
+
+// Returns a client for srv authenticated with key, which is saved with a new
+// random token.
+func keyClient(t *testing.T, srv *httptest.Server, store *database.Store, key *database.APIKey) *http.Client {
+	t.Helper()
+
+	token := auth.NewKey()
+	key.Name = t.Name()
+	key.KeyHash = auth.HashKey(token)
+	err := store.SaveAPIKey(t.Context(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := srv.Client()
+	client.Transport = bearerTransport{token: token, base: client.Transport}
+	return client
+}
+
+// Registers event types named names, without schema.
+func saveEventTypes(t *testing.T, store *database.Store, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		err := store.SaveEventType(t.Context(), &database.EventType{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
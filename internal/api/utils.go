@@ -4,10 +4,24 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
+	"regexp"
+	"strconv"
 
+	"github.com/ffss92/webhookd/internal/validator"
 	"github.com/google/uuid"
 )
 
+const (
+	defaultLimit = 50
+	maxLimit     = 250
+
+	maxUIDLength = 256
+)
+
+var (
+	uidRx = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+)
+
 func (s *Server) writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
 	b, err := json.Marshal(v)
 	if err != nil {
@@ -32,3 +46,57 @@ func uuidParam(r *http.Request, key string) (uuid.UUID, error) {
 	}
 	return id, nil
 }
+
+// Validates an optional uid. Uids that parse as a UUID are rejected, so route
+// parameters accepting both are never ambiguous.
+func checkUID(v *validator.Validator, uid string) {
+	if uid == "" {
+		return
+	}
+	v.Check(validator.MaxLength(uid, maxUIDLength), "uid", "Must have at most 256 characters")
+	v.Check(validator.Matches(uid, uidRx), "uid", "Must only contain letters, digits, '-', '_' and '.'")
+	v.Check(uuid.Validate(uid) != nil, "uid", "Must not be a UUID")
+}
+
+// Returns nil for an empty string, which is encoded as null.
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// Parses the "limit" query parameter, falling back to defaultLimit when it is
+// missing or invalid and capping it at maxLimit.
+func limitParam(r *http.Request) int {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		return defaultLimit
+	}
+	return min(limit, maxLimit)
+}
+
+// A field of a JSON merge patch request, which tells apart a missing field,
+// that must be left unchanged, from an explicit null, that resets it.
+type Optional[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+func (o *Optional[T]) UnmarshalJSON(b []byte) error {
+	o.Set = true
+	if string(b) == "null" {
+		o.Null = true
+		return nil
+	}
+	return json.Unmarshal(b, &o.Value)
+}
+
+// Envelope of paginated listings. NextCursor is passed back as the "cursor"
+// query parameter to get the next page.
+type ListResponse[T any] struct {
+	Data       []T     `json:"data"`
+	NextCursor *string `json:"next_cursor"`
+	HasMore    bool    `json:"has_more"`
+}
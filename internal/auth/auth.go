@@ -0,0 +1,67 @@
+// Package auth defines the API keys used to access the management API and
+// the scopes they can be granted.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"slices"
+)
+
+const (
+	// Prefix of every API key, makes leaked keys easy to identify.
+	KeyPrefix = "whk_"
+)
+
+const (
+	// Grants every other scope, including managing API keys.
+	ScopeAdmin            = "admin"
+	ScopeSubscribersRead  = "subscribers:read"
+	ScopeSubscribersWrite = "subscribers:write"
+	ScopeEndpointsRead    = "endpoints:read"
+	ScopeEndpointsWrite   = "endpoints:write"
+	ScopeSecretsRead      = "secrets:read"
+	ScopeMessagesWrite    = "messages:write"
+	ScopeAttemptsRead     = "attempts:read"
+	ScopeAttemptsWrite    = "attempts:write"
+	ScopePortalWrite      = "portal:write"
+	ScopeEventTypesRead   = "event-types:read"
+	ScopeEventTypesWrite  = "event-types:write"
+)
+
+// All the scopes an API key can be granted.
+var Scopes = []string{
+	ScopeAdmin,
+	ScopeSubscribersRead,
+	ScopeSubscribersWrite,
+	ScopeEndpointsRead,
+	ScopeEndpointsWrite,
+	ScopeSecretsRead,
+	ScopeMessagesWrite,
+	ScopeAttemptsRead,
+	ScopeAttemptsWrite,
+	ScopePortalWrite,
+	ScopeEventTypesRead,
+	ScopeEventTypesWrite,
+}
+
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// Reports whether the granted scopes allow scope.
+func HasScope(granted []string, scope string) bool {
+	return slices.Contains(granted, ScopeAdmin) || slices.Contains(granted, scope)
+}
+
+// Generates a new random API key.
+func NewKey() string {
+	return KeyPrefix + rand.Text()
+}
+
+// Returns the hash stored in place of the key. Keys have enough entropy for a
+// fast hash to be safe.
+func HashKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
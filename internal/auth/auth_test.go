@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHasScope(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		granted []string
+		scope   string
+		want    bool
+	}{
+		{
+			name:    "granted",
+			granted: []string{ScopeEndpointsRead},
+			scope:   ScopeEndpointsRead,
+			want:    true,
+		},
+		{
+			name:    "not granted",
+			granted: []string{ScopeEndpointsRead},
+			scope:   ScopeEndpointsWrite,
+			want:    false,
+		},
+		{
+			name:    "admin",
+			granted: []string{ScopeAdmin},
+			scope:   ScopeSecretsRead,
+			want:    true,
+		},
+		{
+			name:  "no scopes",
+			scope: ScopeSecretsRead,
+			want:  false,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := HasScope(tt.granted, tt.scope); got != tt.want {
+				t.Fatalf("expected %t but got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	t.Parallel()
+
+	key := NewKey()
+	if !strings.HasPrefix(key, KeyPrefix) {
+		t.Fatalf("expected key to start with %q but got %q", KeyPrefix, key)
+	}
+	if key == NewKey() {
+		t.Fatal("expected keys to be random")
+	}
+	if !bytes.Equal(HashKey(key), HashKey(key)) {
+		t.Fatal("expected hash to be deterministic")
+	}
+}
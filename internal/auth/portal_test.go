@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParsePortalToken(t *testing.T) {
+	t.Parallel()
+
+	key := []byte(strings.Repeat("k", 32))
+	appID := uuid.New()
+	subID := uuid.New()
+	now := time.Now()
+	token := SignPortalToken(key, appID, subID, now.Add(time.Hour))
+
+	// Another subscriber's payload with the original signature.
+	payload, _, _ := strings.Cut(SignPortalToken(key, appID, uuid.New(), now.Add(time.Hour)), ".")
+	_, signature, _ := strings.Cut(token, ".")
+	tampered := payload + "." + signature
+
+	testCases := []struct {
+		name    string
+		key     []byte
+		token   string
+		now     time.Time
+		wantErr error
+	}{
+		{
+			name:  "valid token",
+			key:   key,
+			token: token,
+			now:   now,
+		},
+		{
+			name:    "expired token",
+			key:     key,
+			token:   token,
+			now:     now.Add(2 * time.Hour),
+			wantErr: ErrExpiredToken,
+		},
+		{
+			name:    "wrong key",
+			key:     []byte(strings.Repeat("x", 32)),
+			token:   token,
+			now:     now,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "tampered payload",
+			key:     key,
+			token:   tampered,
+			now:     now,
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "api key",
+			key:     key,
+			token:   NewKey(),
+			now:     now,
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			claims, err := ParsePortalToken(tt.key, tt.token, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v but got %v", tt.wantErr, err)
+			}
+			if err == nil && claims.SubscriberID != subID {
+				t.Fatalf("expected subscriber %s but got %s", subID, claims.SubscriberID)
+			}
+			if err == nil && claims.ApplicationID != appID {
+				t.Fatalf("expected application %s but got %s", appID, claims.ApplicationID)
+			}
+		})
+	}
+}
@@ -1,9 +1,14 @@
 package config
 
 import (
+	"encoding/base64"
 	"fmt"
+	"time"
 
 	"github.com/caarlos0/env/v11"
+	"github.com/ffss92/webhookd/internal/keyring"
+	"github.com/ffss92/webhookd/internal/retry"
+	"github.com/ffss92/webhookd/internal/webhook"
 )
 
 type Config struct {
@@ -15,6 +20,34 @@ type Config struct {
 	DatabaseHost string `env:"DATABASE_HOST,notEmpty"`
 	DatabasePort int    `env:"DATABASE_PORT,notEmpty"`
 	DatabaseDB   string `env:"DATABASE_DB,notEmpty"`
+
+	DispatcherPollInterval time.Duration `env:"DISPATCHER_POLL_INTERVAL" envDefault:"5s"`
+	DispatcherBatchSize    int           `env:"DISPATCHER_BATCH_SIZE" envDefault:"100"`
+	DispatcherWorkers      int           `env:"DISPATCHER_WORKERS" envDefault:"20"`
+	DeliveryTimeout        time.Duration `env:"DELIVERY_TIMEOUT" envDefault:"15s"`
+	DeliveryAllowPrivate   bool          `env:"DELIVERY_ALLOW_PRIVATE" envDefault:"false"`
+	EndpointMaxInFlight    int           `env:"ENDPOINT_MAX_IN_FLIGHT" envDefault:"5"`
+	EndpointDisableAfter   time.Duration `env:"ENDPOINT_DISABLE_AFTER" envDefault:"120h"`
+
+	RetrySchedule []time.Duration `env:"RETRY_SCHEDULE" envSeparator:"," envDefault:"0s,5s,5m,30m,2h,5h,10h,10h"`
+	RetryJitter   float64         `env:"RETRY_JITTER" envDefault:"0.2"`
+
+	IdempotencyRetention  time.Duration `env:"IDEMPOTENCY_RETENTION" envDefault:"24h"`
+	SecretRotationOverlap time.Duration `env:"SECRET_ROTATION_OVERLAP" envDefault:"24h"`
+
+	// Base64 encoded key encryption keys by version, endpoint secrets are
+	// stored in plaintext when empty.
+	SecretKeys       map[string]string `env:"SECRET_KEYS" json:"-"`
+	SecretKeyVersion string            `env:"SECRET_KEY_VERSION"`
+
+	// Base64 encoded HMAC key for portal tokens, which are disabled when empty.
+	PortalSigningKey string        `env:"PORTAL_SIGNING_KEY" json:"-"`
+	PortalTokenTTL   time.Duration `env:"PORTAL_TOKEN_TTL" envDefault:"1h"`
+
+	// Operational events, such as disabled endpoints, are POSTed to this URL
+	// signed with EVENTS_WEBHOOK_SECRET. They are only logged when empty.
+	EventsWebhookURL    string `env:"EVENTS_WEBHOOK_URL"`
+	EventsWebhookSecret string `env:"EVENTS_WEBHOOK_SECRET" json:"-"`
 }
 
 func NewFromEnv() (*Config, error) {
@@ -23,6 +56,44 @@ func NewFromEnv() (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	if cfg.DispatcherWorkers < 1 {
+		return nil, fmt.Errorf("DISPATCHER_WORKERS must be at least 1")
+	}
+	if cfg.EndpointMaxInFlight < 1 {
+		return nil, fmt.Errorf("ENDPOINT_MAX_IN_FLIGHT must be at least 1")
+	}
+	if cfg.EndpointDisableAfter < 0 {
+		return nil, fmt.Errorf("ENDPOINT_DISABLE_AFTER must not be negative")
+	}
+	if cfg.SecretRotationOverlap < 0 {
+		return nil, fmt.Errorf("SECRET_ROTATION_OVERLAP must not be negative")
+	}
+	if len(cfg.RetrySchedule) == 0 {
+		return nil, fmt.Errorf("RETRY_SCHEDULE must have at least one entry")
+	}
+	if err := retry.CheckSchedule(cfg.RetrySchedule); err != nil {
+		return nil, fmt.Errorf("RETRY_SCHEDULE %w", err)
+	}
+	if cfg.RetryJitter < 0 || cfg.RetryJitter > 1 {
+		return nil, fmt.Errorf("RETRY_JITTER must be between 0 and 1")
+	}
+	if cfg.PortalSigningKey != "" {
+		key, err := base64.StdEncoding.DecodeString(cfg.PortalSigningKey)
+		if err != nil || len(key) < 32 {
+			return nil, fmt.Errorf("PORTAL_SIGNING_KEY must be at least 32 base64 encoded bytes")
+		}
+	}
+	if cfg.PortalTokenTTL <= 0 {
+		return nil, fmt.Errorf("PORTAL_TOKEN_TTL must be positive")
+	}
+	if cfg.EventsWebhookURL != "" {
+		if _, err := webhook.ParseSecret(cfg.EventsWebhookSecret); err != nil {
+			return nil, fmt.Errorf("EVENTS_WEBHOOK_SECRET must be a whsec_ prefixed secret when EVENTS_WEBHOOK_URL is set")
+		}
+	}
+	if _, err := cfg.Keyring(); err != nil {
+		return nil, fmt.Errorf("invalid SECRET_KEYS: %w", err)
+	}
 	return &cfg, nil
 }
 
@@ -36,3 +107,37 @@ func (c Config) DBConn() string {
 func (c Config) Addr() string {
 	return fmt.Sprintf(":%d", c.Port)
 }
+
+func (c Config) RetryPolicy() retry.Policy {
+	return retry.Policy{
+		Schedule: c.RetrySchedule,
+		Jitter:   c.RetryJitter,
+	}
+}
+
+// Returns the keyring used to encrypt endpoint secrets, nil when no keys are
+// configured.
+func (c Config) Keyring() (*keyring.Keyring, error) {
+	if len(c.SecretKeys) == 0 {
+		return nil, nil
+	}
+
+	keys := make(map[string][]byte, len(c.SecretKeys))
+	for version, encoded := range c.SecretKeys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode key %q: %w", version, err)
+		}
+		keys[version] = key
+	}
+	return keyring.New(keys, c.SecretKeyVersion)
+}
+
+// Returns the key portal tokens are signed with, nil when they are disabled.
+func (c Config) PortalKey() []byte {
+	key, err := base64.StdEncoding.DecodeString(c.PortalSigningKey)
+	if err != nil || len(key) == 0 {
+		return nil
+	}
+	return key
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type APIKey struct {
+	ID            uuid.UUID
+	ApplicationID uuid.UUID
+	Name          string
+	// Hash of the key, the key itself is never stored.
+	KeyHash []byte
+	Scopes  []string
+	// Restricts the key to the resources of a single subscriber when set.
+	SubscriberID *uuid.UUID
+	LastUsedAt   *time.Time
+	CreatedAt    time.Time
+}
+
+func (s Store) SaveAPIKey(ctx context.Context, key *APIKey) error {
+	key.ApplicationID = s.applicationFor(key.ApplicationID)
+
+	query := `
+	INSERT INTO api_keys (application_id, name, key_hash, scopes, subscriber_id)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+	args := []any{key.ApplicationID, key.Name, key.KeyHash, key.Scopes, key.SubscriberID}
+
+	err := s.pool.QueryRow(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save api key: %w", err)
+	}
+	return nil
+}
+
+func (s Store) GetAPIKeyByHash(ctx context.Context, hash []byte) (*APIKey, error) {
+	query := `
+	SELECT id, application_id, name, key_hash, scopes, subscriber_id, last_used_at, created_at
+	FROM api_keys
+	WHERE key_hash = $1
+	AND ($2::UUID IS NULL OR application_id = $2)`
+
+	var key APIKey
+	err := s.pool.QueryRow(ctx, query, hash, s.application).Scan(
+		&key.ID,
+		&key.ApplicationID,
+		&key.Name,
+		&key.KeyHash,
+		&key.Scopes,
+		&key.SubscriberID,
+		&key.LastUsedAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &key, nil
+}
+
+// Records that the key was used. The timestamp is only updated once per
+// minute, to avoid a write for every request.
+func (s Store) TouchAPIKey(ctx context.Context, keyID uuid.UUID) error {
+	query := `
+	UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute')`
+	_, err := s.pool.Exec(ctx, query, keyID)
+	if err != nil {
+		return fmt.Errorf("failed to touch api key: %w", err)
+	}
+	return nil
+}
+
+func (s Store) DeleteAPIKey(ctx context.Context, keyID uuid.UUID) error {
+	query := `
+	DELETE FROM api_keys
+	WHERE id = $1
+	AND ($2::UUID IS NULL OR application_id = $2)`
+	tag, err := s.pool.Exec(ctx, query, keyID, s.application)
+	if err != nil {
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
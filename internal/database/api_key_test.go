@@ -0,0 +1,68 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ffss92/webhookd/internal/auth"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	sub := &Subscriber{
+		Name: "test",
+	}
+	err := store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := &APIKey{
+		Name:         "test",
+		KeyHash:      auth.HashKey(auth.NewKey()),
+		Scopes:       []string{auth.ScopeEndpointsRead},
+		SubscriberID: &sub.ID,
+	}
+	err = store.SaveAPIKey(t.Context(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := store.GetAPIKeyByHash(t.Context(), key.KeyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(key, read); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	err = store.TouchAPIKey(t.Context(), key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err = store.GetAPIKeyByHash(t.Context(), key.KeyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.LastUsedAt == nil {
+		t.Fatal("expected last used timestamp to be set")
+	}
+
+	err = store.DeleteAPIKey(t.Context(), key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.GetAPIKeyByHash(t.Context(), key.KeyHash)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected deleted key to not be found but got %v", err)
+	}
+	err = store.DeleteAPIKey(t.Context(), key.ID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Application created by the migration that introduced applications, which
+// owns the data created before them.
+var DefaultApplicationID = uuid.MustParse("00000000-0000-4000-8000-000000000001")
+
+// Application isolates a set of subscribers, with their endpoints and
+// messages, and the API keys allowed to manage them.
+type Application struct {
+	ID   uuid.UUID
+	Name string
+	// Used by endpoints without their own retry schedule, the default
+	// schedule is used when empty.
+	RetrySchedule []time.Duration
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (s Store) SaveApplication(ctx context.Context, app *Application) error {
+	app.RetrySchedule = secondsToSchedule(scheduleToSeconds(app.RetrySchedule))
+
+	query := `
+	INSERT INTO applications (name, retry_schedule)
+	VALUES ($1, $2)
+	RETURNING id, created_at, updated_at`
+	args := []any{app.Name, scheduleToSeconds(app.RetrySchedule)}
+
+	err := s.pool.QueryRow(ctx, query, args...).Scan(&app.ID, &app.CreatedAt, &app.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save application: %w", err)
+	}
+	return nil
+}
+
+func (s Store) GetApplication(ctx context.Context, appID uuid.UUID) (*Application, error) {
+	query := `
+	SELECT id, name, retry_schedule, created_at, updated_at
+	FROM applications
+	WHERE id = $1
+	AND ($2::UUID IS NULL OR id = $2)`
+
+	app, err := scanApplication(s.pool.QueryRow(ctx, query, appID, s.application))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, fmt.Errorf("failed to get application: %w", err)
+		}
+	}
+	return app, nil
+}
+
+// Returns the application that owns the subscriber.
+func (s Store) GetSubscriberApplication(ctx context.Context, subID uuid.UUID) (*Application, error) {
+	query := `
+	SELECT a.id, a.name, a.retry_schedule, a.created_at, a.updated_at
+	FROM applications a
+	JOIN subscribers s ON s.application_id = a.id
+	WHERE s.id = $1
+	AND ($2::UUID IS NULL OR a.id = $2)`
+
+	app, err := scanApplication(s.pool.QueryRow(ctx, query, subID, s.application))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, fmt.Errorf("failed to get subscriber application: %w", err)
+		}
+	}
+	return app, nil
+}
+
+func scanApplication(row pgx.Row) (*Application, error) {
+	var app Application
+	var retrySchedule []int32
+	err := row.Scan(&app.ID, &app.Name, &retrySchedule, &app.CreatedAt, &app.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	app.RetrySchedule = secondsToSchedule(retrySchedule)
+	return &app, nil
+}
+
+func (s Store) UpdateApplication(ctx context.Context, app *Application) error {
+	app.RetrySchedule = secondsToSchedule(scheduleToSeconds(app.RetrySchedule))
+
+	query := `
+	UPDATE applications SET
+		name = $2,
+		retry_schedule = $3,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	AND ($4::UUID IS NULL OR id = $4)
+	RETURNING updated_at`
+	args := []any{app.ID, app.Name, scheduleToSeconds(app.RetrySchedule), s.application}
+
+	err := s.pool.QueryRow(ctx, query, args...).Scan(&app.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrNotFound
+		default:
+			return fmt.Errorf("failed to update application: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestApplicationLifecycle(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	app := &Application{
+		Name:          "test",
+		RetrySchedule: []time.Duration{0, time.Minute},
+	}
+	err := store.SaveApplication(t.Context(), app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := store.GetApplication(t.Context(), app.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(app, read); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	app.Name = "test-updated"
+	app.RetrySchedule = nil
+	err = store.UpdateApplication(t.Context(), app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := &Subscriber{Name: "test", ApplicationID: app.ID}
+	err = store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err = store.GetSubscriberApplication(t.Context(), sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(app, read); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestSaveSubscriber_DefaultApplication(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	sub := &Subscriber{Name: "test"}
+	err := store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.ApplicationID != DefaultApplicationID {
+		t.Fatalf("expected application %s but got %s", DefaultApplicationID, sub.ApplicationID)
+	}
+}
+
+func TestForApplication(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	apps := make([]*Application, 2)
+	for i := range apps {
+		apps[i] = &Application{Name: "test"}
+		err := store.SaveApplication(t.Context(), apps[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	owner := store.ForApplication(apps[0].ID)
+	other := store.ForApplication(apps[1].ID)
+
+	// The scoped store ignores the requested application.
+	sub := &Subscriber{Name: "test", ApplicationID: apps[1].ID}
+	err := owner.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.ApplicationID != apps[0].ID {
+		t.Fatalf("expected application %s but got %s", apps[0].ID, sub.ApplicationID)
+	}
+
+	endpoint := &Endpoint{
+		Label:        "test",
+		URL:          "https://example.com",
+		Secret:       "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw",
+		SubscriberID: sub.ID,
+	}
+	err = owner.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &Message{
+		Type:         "test.created",
+		Data:         json.RawMessage(`{}`),
+		SubscriberID: sub.ID,
+	}
+	err = owner.SaveMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := owner.GetSubscriber(t.Context(), sub.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := owner.GetEndpoint(t.Context(), endpoint.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := owner.GetMessage(t.Context(), msg.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name string
+		fn   func() error
+	}{
+		{
+			name: "get subscriber",
+			fn: func() error {
+				_, err := other.GetSubscriber(t.Context(), sub.ID)
+				return err
+			},
+		},
+		{
+			name: "update subscriber",
+			fn: func() error {
+				return other.UpdateSubscriber(t.Context(), sub)
+			},
+		},
+		{
+			name: "get endpoint",
+			fn: func() error {
+				_, err := other.GetEndpoint(t.Context(), endpoint.ID)
+				return err
+			},
+		},
+		{
+			name: "save endpoint",
+			fn: func() error {
+				return other.SaveEndpoint(t.Context(), &Endpoint{
+					Label:        "test",
+					URL:          "https://example.com",
+					Secret:       "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw",
+					SubscriberID: sub.ID,
+				})
+			},
+		},
+		{
+			name: "update endpoint",
+			fn: func() error {
+				return other.UpdateEndpoint(t.Context(), endpoint)
+			},
+		},
+		{
+			name: "get message",
+			fn: func() error {
+				_, err := other.GetMessage(t.Context(), msg.ID)
+				return err
+			},
+		},
+		{
+			name: "save message",
+			fn: func() error {
+				return other.SaveMessage(t.Context(), &Message{
+					Type:         "test.created",
+					Data:         json.RawMessage(`{}`),
+					SubscriberID: sub.ID,
+				})
+			},
+		},
+		{
+			name: "get application",
+			fn: func() error {
+				_, err := other.GetApplication(t.Context(), apps[0].ID)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		if err := tt.fn(); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: expected ErrNotFound but got %v", tt.name, err)
+		}
+	}
+
+	subs, err := other.ListSubscribers(t.Context(), ListSubscribersParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 0 {
+		t.Fatalf("expected no subscribers but got %d", len(subs))
+	}
+
+	err = other.DeleteSubscriber(t.Context(), sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := owner.GetSubscriber(t.Context(), sub.ID); err != nil {
+		t.Fatalf("expected subscriber to not be deleted by another application: %v", err)
+	}
+}
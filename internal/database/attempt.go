@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type Attempt struct {
+	ID              uuid.UUID
+	MessageID       uuid.UUID
+	EndpointID      uuid.UUID
+	Attempt         int
+	StatusCode      int
+	ResponseHeaders http.Header
+	ResponseBody    string
+	Latency         time.Duration
+	Error           string
+	CreatedAt       time.Time
+}
+
+// Saves a delivery attempt. The attempt number is assigned based on the
+// previous attempts of the same message to the same endpoint.
+func (s Store) SaveAttempt(ctx context.Context, attempt *Attempt) error {
+	if attempt.ResponseHeaders == nil {
+		attempt.ResponseHeaders = make(http.Header)
+	}
+
+	query := `
+	INSERT INTO message_attempts (
+		message_id, endpoint_id, attempt, status_code,
+		response_headers, response_body, latency_ms, error
+	)
+	VALUES (
+		$1, $2,
+		(SELECT COUNT(*) + 1 FROM message_attempts WHERE message_id = $1 AND endpoint_id = $2),
+		$3, $4, $5, $6, $7
+	)
+	RETURNING id, attempt, created_at`
+	args := []any{
+		attempt.MessageID,
+		attempt.EndpointID,
+		attempt.StatusCode,
+		attempt.ResponseHeaders,
+		attempt.ResponseBody,
+		attempt.Latency.Milliseconds(),
+		attempt.Error,
+	}
+
+	err := s.pool.QueryRow(ctx, query, args...).Scan(&attempt.ID, &attempt.Attempt, &attempt.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save attempt: %w", err)
+	}
+	return nil
+}
+
+type ListAttemptsParams struct {
+	MessageID  *uuid.UUID
+	EndpointID *uuid.UUID
+	Limit      int
+}
+
+// Lists attempts matching params, newest first.
+func (s Store) ListAttempts(ctx context.Context, params ListAttemptsParams) ([]*Attempt, error) {
+	query := `
+	SELECT
+		id, message_id, endpoint_id, attempt, status_code,
+		response_headers, response_body, latency_ms, error, created_at
+	FROM message_attempts
+	WHERE (message_id = $1 OR $1 IS NULL)
+	AND (endpoint_id = $2 OR $2 IS NULL)
+	AND ($4::UUID IS NULL OR endpoint_id IN (
+		SELECT e.id FROM endpoints e
+		JOIN subscribers s ON s.id = e.subscriber_id
+		WHERE s.application_id = $4
+	))
+	ORDER BY created_at DESC, attempt DESC
+	LIMIT $3`
+	args := []any{params.MessageID, params.EndpointID, params.Limit, s.application}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attempts: %w", err)
+	}
+	defer rows.Close()
+
+	attempts := make([]*Attempt, 0)
+	for rows.Next() {
+		attempt, err := scanAttempt(rows)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+func scanAttempt(row pgx.Row) (*Attempt, error) {
+	var attempt Attempt
+	var latencyMs int64
+	err := row.Scan(
+		&attempt.ID, &attempt.MessageID, &attempt.EndpointID, &attempt.Attempt, &attempt.StatusCode,
+		&attempt.ResponseHeaders, &attempt.ResponseBody, &latencyMs, &attempt.Error, &attempt.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	attempt.Latency = time.Duration(latencyMs) * time.Millisecond
+	return &attempt, nil
+}
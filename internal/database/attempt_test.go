@@ -0,0 +1,98 @@
+package database
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAttemptLifecycle(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	sub := &Subscriber{
+		Name: "test",
+	}
+	err := store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &Endpoint{
+		Label:        "test",
+		URL:          "http://test.com",
+		SubscriberID: sub.ID,
+	}
+	err = store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &Message{
+		Type:         "test.created",
+		Data:         json.RawMessage(`{}`),
+		SubscriberID: sub.ID,
+	}
+	err = store.SaveMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attempts := []*Attempt{
+		{
+			MessageID:  msg.ID,
+			EndpointID: endpoint.ID,
+			StatusCode: http.StatusInternalServerError,
+			ResponseHeaders: http.Header{
+				"Content-Type": {"text/plain"},
+			},
+			ResponseBody: "something went wrong",
+			Latency:      120 * time.Millisecond,
+			Error:        "unexpected status code: 500",
+		},
+		{
+			MessageID:  msg.ID,
+			EndpointID: endpoint.ID,
+			StatusCode: http.StatusNoContent,
+			Latency:    80 * time.Millisecond,
+		},
+	}
+	for i, attempt := range attempts {
+		err := store.SaveAttempt(t.Context(), attempt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if attempt.Attempt != i+1 {
+			t.Fatalf("expected attempt number %d but got %d", i+1, attempt.Attempt)
+		}
+	}
+
+	expected := []*Attempt{attempts[1], attempts[0]}
+
+	got, err := store.ListAttempts(t.Context(), ListAttemptsParams{
+		MessageID: &msg.ID,
+		Limit:     10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expected, got); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	got, err = store.ListAttempts(t.Context(), ListAttemptsParams{
+		EndpointID: &endpoint.ID,
+		Limit:      1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(expected[:1], got); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+}
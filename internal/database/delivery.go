@@ -0,0 +1,359 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type DeliveryStatus string
+
+const (
+	// Claims look at more candidates than requested, as some of them may be
+	// skipped to respect endpoint in-flight limits.
+	candidatesFactor = 4
+)
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// Delivery tracks the state of a message being sent to a single endpoint.
+type Delivery struct {
+	ID            uuid.UUID
+	MessageID     uuid.UUID
+	EndpointID    uuid.UUID
+	Status        DeliveryStatus
+	Attempts      int
+	NextAttemptAt *time.Time
+	LastAttemptAt *time.Time
+	// Set while a worker holds the delivery, which is claimable again by
+	// other workers once it expires.
+	LockedUntil *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Creates a pending delivery of msgID for each endpoint, due immediately.
+// Existing deliveries are left untouched.
+func (s Store) SaveDeliveries(ctx context.Context, msgID uuid.UUID, endpointIDs []uuid.UUID) error {
+	query := `
+	INSERT INTO deliveries (message_id, endpoint_id, next_attempt_at)
+	SELECT $1, endpoint_id, CURRENT_TIMESTAMP
+	FROM unnest($2::UUID[]) AS endpoint_id
+	ON CONFLICT (message_id, endpoint_id) DO NOTHING`
+
+	_, err := s.pool.Exec(ctx, query, msgID, endpointIDs)
+	if err != nil {
+		return fmt.Errorf("failed to save deliveries: %w", err)
+	}
+	return nil
+}
+
+// Queues a delivery of msg to every enabled endpoint of its subscriber that
+// accepts its type and marks it as dispatched. Returns the matched endpoints.
+// Should be called inside a transaction.
+func (s Store) EnqueueMessage(ctx context.Context, msg *Message) ([]*Endpoint, error) {
+	disabled := false
+	endpoints, err := s.ListEndpoints(ctx, ListEndpointsParams{
+		SubscriberID: msg.SubscriberID,
+		Disabled:     &disabled,
+		FilterType:   &msg.Type,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list endpoints: %w", err)
+	}
+
+	endpointIDs := make([]uuid.UUID, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		endpointIDs = append(endpointIDs, endpoint.ID)
+	}
+
+	if err := s.SaveDeliveries(ctx, msg.ID, endpointIDs); err != nil {
+		return nil, err
+	}
+	if err := s.MarkMessageDispatched(ctx, msg); err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// Lists the endpoints msgID was queued for.
+func (s Store) ListMessageEndpoints(ctx context.Context, msgID uuid.UUID) ([]*Endpoint, error) {
+	query := `
+	SELECT
+		id, COALESCE(uid, ''), label, url, secret, COALESCE(previous_secret, ''),
+		previous_secret_expires_at, disabled, filter_types, version_pins, subscriber_id,
+		retry_schedule, COALESCE(max_in_flight, 0), consecutive_failures,
+		failing_since, created_at, updated_at
+	FROM endpoints
+	WHERE id IN (SELECT endpoint_id FROM deliveries WHERE message_id = $1)
+	AND ($2::UUID IS NULL OR subscriber_id IN (SELECT id FROM subscribers WHERE application_id = $2))
+	ORDER BY created_at`
+
+	rows, err := s.pool.Query(ctx, query, msgID, s.application)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message endpoints: %w", err)
+	}
+	defer rows.Close()
+
+	endpoints := make([]*Endpoint, 0)
+	for rows.Next() {
+		endpoint, err := s.scanEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+func (s Store) GetDelivery(ctx context.Context, msgID, endpointID uuid.UUID) (*Delivery, error) {
+	query := `
+	SELECT
+		id, message_id, endpoint_id, status, attempts, next_attempt_at,
+		last_attempt_at, locked_until, created_at, updated_at
+	FROM deliveries
+	WHERE message_id = $1 AND endpoint_id = $2
+	AND ($3::UUID IS NULL OR endpoint_id IN (
+		SELECT e.id FROM endpoints e
+		JOIN subscribers s ON s.id = e.subscriber_id
+		WHERE s.application_id = $3
+	))`
+
+	delivery, err := scanDelivery(s.pool.QueryRow(ctx, query, msgID, endpointID, s.application))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, fmt.Errorf("failed to get delivery: %w", err)
+		}
+	}
+	return delivery, nil
+}
+
+type ClaimDeliveriesParams struct {
+	Limit int
+	// How long claimed deliveries stay locked.
+	Lease time.Duration
+	// Concurrent deliveries allowed per endpoint, unless overridden by the
+	// endpoint itself.
+	MaxInFlight int
+}
+
+// Locks up to limit due deliveries to enabled endpoints for the lease
+// duration, oldest first. Endpoints being claimed by other transactions are
+// skipped, which allows multiple workers to claim concurrently. Endpoints
+// never have more locked deliveries than their in-flight limit, so a slow
+// endpoint cannot take over every worker. Must be called inside a
+// transaction.
+func (s Store) ClaimDeliveries(ctx context.Context, params ClaimDeliveriesParams) ([]*Delivery, error) {
+	// Endpoint rows are locked until the transaction ends, so concurrent
+	// claims can't both count the same in-flight deliveries. Full endpoints
+	// are left out here, but the count is only trusted in a later statement,
+	// which sees claims committed before the lock was taken.
+	query := `
+	SELECT e.id
+	FROM endpoints e
+	JOIN (
+		SELECT endpoint_id, MIN(next_attempt_at) AS next_attempt_at
+		FROM deliveries
+		WHERE status = 'pending'
+		AND next_attempt_at <= CURRENT_TIMESTAMP
+		AND (locked_until IS NULL OR locked_until <= CURRENT_TIMESTAMP)
+		GROUP BY endpoint_id
+	) d ON d.endpoint_id = e.id
+	LEFT JOIN (
+		SELECT endpoint_id, COUNT(*) AS in_flight
+		FROM deliveries
+		WHERE locked_until > CURRENT_TIMESTAMP
+		GROUP BY endpoint_id
+	) f ON f.endpoint_id = e.id
+	WHERE NOT e.disabled
+	AND COALESCE(e.max_in_flight, $2) > COALESCE(f.in_flight, 0)
+	ORDER BY d.next_attempt_at
+	LIMIT $1
+	FOR NO KEY UPDATE OF e SKIP LOCKED`
+
+	rows, err := s.pool.Query(ctx, query, params.Limit, params.MaxInFlight)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock endpoints: %w", err)
+	}
+	endpointIDs, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock endpoints: %w", err)
+	}
+	if len(endpointIDs) == 0 {
+		return []*Delivery{}, nil
+	}
+
+	// Candidates are limited to endpoints with spare capacity, then ranked
+	// per endpoint so a single claim does not exceed it either.
+	query = `
+	WITH in_flight AS (
+		SELECT endpoint_id, COUNT(*) AS in_flight
+		FROM deliveries
+		WHERE endpoint_id = ANY($4)
+		AND locked_until > CURRENT_TIMESTAMP
+		GROUP BY endpoint_id
+	), candidates AS (
+		SELECT
+			d.id, d.endpoint_id, d.next_attempt_at,
+			COALESCE(e.max_in_flight, $2) - COALESCE(f.in_flight, 0) AS available
+		FROM deliveries d
+		JOIN endpoints e ON e.id = d.endpoint_id
+		LEFT JOIN in_flight f ON f.endpoint_id = d.endpoint_id
+		WHERE d.endpoint_id = ANY($4)
+		AND d.status = 'pending'
+		AND d.next_attempt_at <= CURRENT_TIMESTAMP
+		AND (d.locked_until IS NULL OR d.locked_until <= CURRENT_TIMESTAMP)
+		AND COALESCE(e.max_in_flight, $2) > COALESCE(f.in_flight, 0)
+		ORDER BY d.next_attempt_at
+		LIMIT $3
+		FOR UPDATE OF d SKIP LOCKED
+	), ranked AS (
+		SELECT
+			id, next_attempt_at, available,
+			ROW_NUMBER() OVER (PARTITION BY endpoint_id ORDER BY next_attempt_at) AS position
+		FROM candidates
+	)
+	SELECT
+		d.id, d.message_id, d.endpoint_id, d.status, d.attempts, d.next_attempt_at,
+		d.last_attempt_at, d.locked_until, d.created_at, d.updated_at
+	FROM deliveries d
+	JOIN ranked r ON r.id = d.id
+	WHERE r.position <= r.available
+	ORDER BY r.next_attempt_at
+	LIMIT $1`
+	args := []any{params.Limit, params.MaxInFlight, params.Limit * candidatesFactor, endpointIDs}
+
+	rows, err = s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]*Delivery, 0)
+	ids := make([]uuid.UUID, 0)
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+		ids = append(ids, delivery.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+
+	var lockedUntil time.Time
+	query = `SELECT CURRENT_TIMESTAMP + make_interval(secs => $1)`
+	err = s.pool.QueryRow(ctx, query, params.Lease.Seconds()).Scan(&lockedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute lock expiration: %w", err)
+	}
+
+	query = `UPDATE deliveries SET locked_until = $2 WHERE id = ANY($1)`
+	_, err = s.pool.Exec(ctx, query, ids, lockedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock deliveries: %w", err)
+	}
+
+	for _, delivery := range deliveries {
+		delivery.LockedUntil = &lockedUntil
+	}
+	return deliveries, nil
+}
+
+func scanDelivery(row pgx.Row) (*Delivery, error) {
+	var delivery Delivery
+	err := row.Scan(
+		&delivery.ID, &delivery.MessageID, &delivery.EndpointID, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt,
+		&delivery.LastAttemptAt, &delivery.LockedUntil, &delivery.CreatedAt, &delivery.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// Updates the delivery state and releases its lock.
+func (s Store) UpdateDelivery(ctx context.Context, delivery *Delivery) error {
+	delivery.LockedUntil = nil
+
+	query := `
+	UPDATE deliveries SET
+		status = $2,
+		attempts = $3,
+		next_attempt_at = $4,
+		last_attempt_at = $5,
+		locked_until = NULL,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	RETURNING updated_at`
+	args := []any{
+		delivery.ID,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastAttemptAt,
+	}
+
+	err := s.pool.QueryRow(ctx, query, args...).Scan(&delivery.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to update delivery: %w", err)
+	}
+	return nil
+}
+
+// Schedules an immediate attempt of a delivery, regardless of its status.
+// Returns ErrConflict when the delivery is being attempted.
+func (s Store) RetryDelivery(ctx context.Context, msgID, endpointID uuid.UUID) (*Delivery, error) {
+	query := `
+	UPDATE deliveries SET
+		status = $3,
+		next_attempt_at = CURRENT_TIMESTAMP,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE message_id = $1 AND endpoint_id = $2
+	AND (locked_until IS NULL OR locked_until <= CURRENT_TIMESTAMP)
+	AND ($4::UUID IS NULL OR endpoint_id IN (
+		SELECT e.id FROM endpoints e
+		JOIN subscribers s ON s.id = e.subscriber_id
+		WHERE s.application_id = $4
+	))
+	RETURNING
+		id, message_id, endpoint_id, status, attempts, next_attempt_at,
+		last_attempt_at, locked_until, created_at, updated_at`
+
+	delivery, err := scanDelivery(s.pool.QueryRow(ctx, query, msgID, endpointID, DeliveryPending, s.application))
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to retry delivery: %w", err)
+		}
+		if _, err := s.GetDelivery(ctx, msgID, endpointID); err != nil {
+			return nil, err
+		}
+		return nil, ErrConflict
+	}
+
+	_, err = s.pool.Exec(ctx, `SELECT pg_notify($1, $2)`, MessageChannel, msgID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to notify message: %w", err)
+	}
+	return delivery, nil
+}
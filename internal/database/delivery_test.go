@@ -0,0 +1,449 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestDeliveryLifecycle(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	sub := &Subscriber{
+		Name: "test",
+	}
+	err := store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints := []*Endpoint{
+		{
+			Label:        "enabled",
+			URL:          "http://enabled.com",
+			SubscriberID: sub.ID,
+		},
+		{
+			Label:        "disabled",
+			URL:          "http://disabled.com",
+			SubscriberID: sub.ID,
+			Disabled:     true,
+		},
+	}
+	endpointIDs := make([]uuid.UUID, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		err := store.SaveEndpoint(t.Context(), endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		endpointIDs = append(endpointIDs, endpoint.ID)
+	}
+
+	msg := &Message{
+		Type:         "test.created",
+		Data:         json.RawMessage(`{}`),
+		SubscriberID: sub.ID,
+	}
+	err = store.SaveMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.SaveDeliveries(t.Context(), msg.ID, endpointIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Saving again must not fail nor duplicate deliveries.
+	err = store.SaveDeliveries(t.Context(), msg.ID, endpointIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var due []*Delivery
+	err = store.InTx(t.Context(), func(ctx context.Context, store *Store) error {
+		var err error
+		due, err = store.ClaimDeliveries(ctx, ClaimDeliveriesParams{Limit: 10, Lease: time.Minute, MaxInFlight: 5})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 {
+		t.Fatalf("expected 1 due delivery but got %d", len(due))
+	}
+
+	delivery := due[0]
+	if delivery.EndpointID != endpoints[0].ID || delivery.Status != DeliveryPending {
+		t.Fatalf("unexpected due delivery: %+v", delivery)
+	}
+	if delivery.LockedUntil == nil {
+		t.Fatal("expected claimed delivery to be locked")
+	}
+
+	err = store.InTx(t.Context(), func(ctx context.Context, store *Store) error {
+		claimed, err := store.ClaimDeliveries(ctx, ClaimDeliveriesParams{Limit: 10, Lease: time.Minute, MaxInFlight: 5})
+		if err != nil {
+			return err
+		}
+		if len(claimed) != 0 {
+			t.Errorf("expected locked delivery to not be claimed again but got %d", len(claimed))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+	last := time.Now().Truncate(time.Microsecond)
+	delivery.Attempts = 1
+	delivery.NextAttemptAt = &next
+	delivery.LastAttemptAt = &last
+	err = store.UpdateDelivery(t.Context(), delivery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := store.GetDelivery(t.Context(), msg.ID, endpoints[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(delivery, read); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	err = store.InTx(t.Context(), func(ctx context.Context, store *Store) error {
+		var err error
+		due, err = store.ClaimDeliveries(ctx, ClaimDeliveriesParams{Limit: 10, Lease: time.Minute, MaxInFlight: 5})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 0 {
+		t.Fatalf("expected rescheduled delivery to not be due but got %d", len(due))
+	}
+}
+
+func TestGetDelivery_NotFound(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	_, err := store.GetDelivery(t.Context(), uuid.New(), uuid.New())
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+}
+
+func TestClaimDeliveries_SkipLocked(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	sub := &Subscriber{
+		Name: "test",
+	}
+	err := store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpointIDs := make([]uuid.UUID, 0, 2)
+	for range 2 {
+		endpoint := &Endpoint{
+			Label:        "test",
+			URL:          "http://test.com",
+			SubscriberID: sub.ID,
+		}
+		err = store.SaveEndpoint(t.Context(), endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		endpointIDs = append(endpointIDs, endpoint.ID)
+	}
+
+	for _, endpointID := range endpointIDs {
+		msg := &Message{
+			Type:         "test.created",
+			Data:         json.RawMessage(`{}`),
+			SubscriberID: sub.ID,
+		}
+		err = store.SaveMessage(t.Context(), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.SaveDeliveries(t.Context(), msg.ID, []uuid.UUID{endpointID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// While the first transaction holds its endpoint, a concurrent claim must
+	// only see the delivery to the other endpoint.
+	err = store.InTx(t.Context(), func(ctx context.Context, first *Store) error {
+		claimed, err := first.ClaimDeliveries(ctx, ClaimDeliveriesParams{Limit: 1, Lease: time.Minute, MaxInFlight: 5})
+		if err != nil {
+			return err
+		}
+		if len(claimed) != 1 {
+			t.Errorf("expected first claim to get 1 delivery but got %d", len(claimed))
+		}
+
+		return store.InTx(t.Context(), func(ctx context.Context, second *Store) error {
+			claimed, err := second.ClaimDeliveries(ctx, ClaimDeliveriesParams{Limit: 10, Lease: time.Minute, MaxInFlight: 5})
+			if err != nil {
+				return err
+			}
+			if len(claimed) != 1 {
+				t.Errorf("expected second claim to get 1 delivery but got %d", len(claimed))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClaimDeliveries_MaxInFlight(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	sub := &Subscriber{
+		Name: "test",
+	}
+	err := store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints := []*Endpoint{
+		{
+			Label:        "default",
+			URL:          "http://default.com",
+			SubscriberID: sub.ID,
+		},
+		{
+			Label:        "override",
+			URL:          "http://override.com",
+			SubscriberID: sub.ID,
+			MaxInFlight:  1,
+		},
+	}
+	for _, endpoint := range endpoints {
+		err := store.SaveEndpoint(t.Context(), endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for range 3 {
+		msg := &Message{
+			Type:         "test.created",
+			Data:         json.RawMessage(`{}`),
+			SubscriberID: sub.ID,
+		}
+		err = store.SaveMessage(t.Context(), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.SaveDeliveries(t.Context(), msg.ID, []uuid.UUID{endpoints[0].ID, endpoints[1].ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	claim := func() map[uuid.UUID]int {
+		t.Helper()
+
+		var claimed []*Delivery
+		err := store.InTx(t.Context(), func(ctx context.Context, store *Store) error {
+			var err error
+			claimed, err = store.ClaimDeliveries(ctx, ClaimDeliveriesParams{
+				Limit:       10,
+				Lease:       time.Minute,
+				MaxInFlight: 2,
+			})
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		counts := make(map[uuid.UUID]int)
+		for _, delivery := range claimed {
+			counts[delivery.EndpointID]++
+		}
+		return counts
+	}
+
+	// Leased deliveries count towards the limit until they expire.
+	want := map[uuid.UUID]int{endpoints[0].ID: 2, endpoints[1].ID: 1}
+	if diff := cmp.Diff(want, claim()); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[uuid.UUID]int{}, claim()); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+}
+
+func TestClaimDeliveries_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	sub := &Subscriber{
+		Name: "test",
+	}
+	err := store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &Endpoint{
+		Label:        "test",
+		URL:          "http://test.com",
+		SubscriberID: sub.ID,
+		MaxInFlight:  1,
+	}
+	err = store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 4 {
+		msg := &Message{
+			Type:         "test.created",
+			Data:         json.RawMessage(`{}`),
+			SubscriberID: sub.ID,
+		}
+		err = store.SaveMessage(t.Context(), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.SaveDeliveries(t.Context(), msg.ID, []uuid.UUID{endpoint.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Claims racing for the same endpoint must not exceed its limit together.
+	var claimed atomic.Int32
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			err := store.InTx(t.Context(), func(ctx context.Context, store *Store) error {
+				deliveries, err := store.ClaimDeliveries(ctx, ClaimDeliveriesParams{Limit: 10, Lease: time.Minute, MaxInFlight: 5})
+				claimed.Add(int32(len(deliveries)))
+				return err
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if got := claimed.Load(); got != 1 {
+		t.Fatalf("expected 1 claimed delivery but got %d", got)
+	}
+}
+
+func TestRetryDelivery(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	sub := &Subscriber{
+		Name: "test",
+	}
+	err := store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &Endpoint{
+		Label:        "test",
+		URL:          "http://test.com",
+		SubscriberID: sub.ID,
+	}
+	err = store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &Message{
+		Type:         "test.created",
+		Data:         json.RawMessage(`{}`),
+		SubscriberID: sub.ID,
+	}
+	err = store.SaveMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.SaveDeliveries(t.Context(), msg.ID, []uuid.UUID{endpoint.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Being attempted.
+	err = store.InTx(t.Context(), func(ctx context.Context, store *Store) error {
+		_, err := store.ClaimDeliveries(ctx, ClaimDeliveriesParams{Limit: 1, Lease: time.Minute, MaxInFlight: 1})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.RetryDelivery(t.Context(), msg.ID, endpoint.ID)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict but got %v", err)
+	}
+
+	delivery, err := store.GetDelivery(t.Context(), msg.ID, endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := time.Now()
+	delivery.Status = DeliveryFailed
+	delivery.Attempts = 8
+	delivery.LastAttemptAt = &last
+	err = store.UpdateDelivery(t.Context(), delivery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retried, err := store.RetryDelivery(t.Context(), msg.ID, endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.Status != DeliveryPending || retried.NextAttemptAt == nil || retried.Attempts != 8 {
+		t.Fatalf("unexpected retried delivery: %+v", retried)
+	}
+
+	_, err = store.RetryDelivery(t.Context(), uuid.New(), endpoint.ID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+}
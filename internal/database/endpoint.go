@@ -8,22 +8,49 @@ import (
 	"slices"
 	"time"
 
+	"github.com/ffss92/webhookd/internal/filter"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
 
 type Endpoint struct {
-	ID           uuid.UUID
-	Label        string
-	URL          string
-	Secret       string
-	Disabled     bool
-	FilterTypes  []string
+	ID uuid.UUID
+	// Optional identifier chosen by the producer, unique per application.
+	UID    string
+	Label  string
+	URL    string
+	Secret string
+	// Still signs deliveries after a rotation, until it expires.
+	PreviousSecret          string
+	PreviousSecretExpiresAt *time.Time
+	Disabled                bool
+	FilterTypes             []string
+	// Versions of event types the endpoint accepts, by type name. Messages of
+	// newer versions are down-converted before being delivered.
+	VersionPins  map[string]int
 	SubscriberID uuid.UUID
+	// Overrides the default retry schedule when not empty.
+	RetrySchedule []time.Duration
+	// Overrides the default limit of concurrent deliveries when not zero.
+	MaxInFlight int
+	// Failed deliveries since the last successful one.
+	ConsecutiveFailures int
+	// When the current streak of failures started, nil if not failing.
+	FailingSince *time.Time
 	CreatedAt    time.Time
 	UpdatedAt    time.Time
 }
 
+// Returns the secrets deliveries must be signed with at the given time, the
+// current one first.
+func (e *Endpoint) Secrets(now time.Time) []string {
+	secrets := []string{e.Secret}
+	if e.PreviousSecret != "" && e.PreviousSecretExpiresAt != nil && now.Before(*e.PreviousSecretExpiresAt) {
+		secrets = append(secrets, e.PreviousSecret)
+	}
+	return secrets
+}
+
 func removeDuplicates[T comparable](values []T) []T {
 	if values == nil {
 		return make([]T, 0)
@@ -35,29 +62,102 @@ func removeDuplicates[T comparable](values []T) []T {
 	return slices.Collect(maps.Keys(unique))
 }
 
+// Returns the regular expressions of the wildcard filters, which are
+// matched at fan-out alongside the exact ones.
+func filterPatterns(filterTypes []string) ([]string, error) {
+	patterns := make([]string, 0)
+	for _, filterType := range filterTypes {
+		if !filter.IsPattern(filterType) {
+			continue
+		}
+		pattern, err := filter.Regexp(filterType)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// Retry schedules are stored as an array of seconds, NULL meaning the
+// default schedule is used.
+func scheduleToSeconds(schedule []time.Duration) []int32 {
+	if len(schedule) == 0 {
+		return nil
+	}
+	seconds := make([]int32, 0, len(schedule))
+	for _, delay := range schedule {
+		seconds = append(seconds, int32(delay/time.Second))
+	}
+	return seconds
+}
+
+func secondsToSchedule(seconds []int32) []time.Duration {
+	if len(seconds) == 0 {
+		return nil
+	}
+	schedule := make([]time.Duration, 0, len(seconds))
+	for _, s := range seconds {
+		schedule = append(schedule, time.Duration(s)*time.Second)
+	}
+	return schedule
+}
+
 func (s Store) SaveEndpoint(ctx context.Context, endpoint *Endpoint) error {
 	endpoint.FilterTypes = removeDuplicates(endpoint.FilterTypes)
+	endpoint.RetrySchedule = secondsToSchedule(scheduleToSeconds(endpoint.RetrySchedule))
+	if endpoint.VersionPins == nil {
+		endpoint.VersionPins = make(map[string]int)
+	}
+	patterns, err := filterPatterns(endpoint.FilterTypes)
+	if err != nil {
+		return err
+	}
+	if err := s.checkSubscriber(ctx, endpoint.SubscriberID); err != nil {
+		return err
+	}
+	secret, err := s.keyring.Encrypt(endpoint.Secret)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt endpoint secret: %w", err)
+	}
 
 	query := `
-	INSERT INTO endpoints (label, url, secret, filter_types, disabled, subscriber_id)
-	VALUES ($1, $2, $3, $4, $5, $6)
+	INSERT INTO endpoints (
+		label, url, secret, filter_types, disabled,
+		subscriber_id, retry_schedule, max_in_flight, uid, application_id,
+		version_pins, filter_patterns
+	)
+	VALUES (
+		$1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), NULLIF($9, ''),
+		(SELECT application_id FROM subscribers WHERE id = $6), $10, $11
+	)
 	RETURNING id, created_at, updated_at`
 	args := []any{
 		endpoint.Label,
 		endpoint.URL,
-		endpoint.Secret,
+		secret,
 		endpoint.FilterTypes,
 		endpoint.Disabled,
 		endpoint.SubscriberID,
+		scheduleToSeconds(endpoint.RetrySchedule),
+		endpoint.MaxInFlight,
+		endpoint.UID,
+		endpoint.VersionPins,
+		patterns,
 	}
 
-	err := s.pool.QueryRow(ctx, query, args...).Scan(
+	err = s.pool.QueryRow(ctx, query, args...).Scan(
 		&endpoint.ID,
 		&endpoint.CreatedAt,
 		&endpoint.UpdatedAt,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to save endpoint: %w", err)
+		switch {
+		case isUniqueViolation(err):
+			return ErrConflict
+		default:
+			return fmt.Errorf("failed to save endpoint: %w", err)
+		}
 	}
 	return nil
 }
@@ -65,12 +165,40 @@ func (s Store) SaveEndpoint(ctx context.Context, endpoint *Endpoint) error {
 func (s Store) GetEndpoint(ctx context.Context, endpointID uuid.UUID) (*Endpoint, error) {
 	query := `
 	SELECT
-		id, label, url, secret, disabled, 
-		filter_types, subscriber_id, created_at, updated_at
+		id, COALESCE(uid, ''), label, url, secret, COALESCE(previous_secret, ''),
+		previous_secret_expires_at, disabled, filter_types, version_pins, subscriber_id,
+		retry_schedule, COALESCE(max_in_flight, 0), consecutive_failures,
+		failing_since, created_at, updated_at
 	FROM endpoints
-	WHERE id = $1`
+	WHERE id = $1
+	AND ($2::UUID IS NULL OR subscriber_id IN (SELECT id FROM subscribers WHERE application_id = $2))`
 
-	endpoint, err := scanEndpoint(s.pool.QueryRow(ctx, query, endpointID))
+	endpoint, err := s.scanEndpoint(s.pool.QueryRow(ctx, query, endpointID, s.application))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return endpoint, nil
+}
+
+// Gets an endpoint by the uid assigned by the producer. Outside of an
+// application, only endpoints of the default application are found.
+func (s Store) GetEndpointByUID(ctx context.Context, uid string) (*Endpoint, error) {
+	query := `
+	SELECT
+		id, COALESCE(uid, ''), label, url, secret, COALESCE(previous_secret, ''),
+		previous_secret_expires_at, disabled, filter_types, version_pins, subscriber_id,
+		retry_schedule, COALESCE(max_in_flight, 0), consecutive_failures,
+		failing_since, created_at, updated_at
+	FROM endpoints
+	WHERE uid = $1
+	AND application_id = $2`
+
+	endpoint, err := s.scanEndpoint(s.pool.QueryRow(ctx, query, uid, s.applicationFor(uuid.Nil)))
 	if err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
@@ -91,8 +219,10 @@ type ListEndpointsParams struct {
 func (s Store) ListEndpoints(ctx context.Context, params ListEndpointsParams) ([]*Endpoint, error) {
 	query := `
 	SELECT
-		id, label, url, secret, disabled, 
-		filter_types, subscriber_id, created_at, updated_at
+		id, COALESCE(uid, ''), label, url, secret, COALESCE(previous_secret, ''),
+		previous_secret_expires_at, disabled, filter_types, version_pins, subscriber_id,
+		retry_schedule, COALESCE(max_in_flight, 0), consecutive_failures,
+		failing_since, created_at, updated_at
 	FROM endpoints
 	WHERE subscriber_id = $1
 	AND (disabled = $2 OR $2 IS NULL)
@@ -100,8 +230,10 @@ func (s Store) ListEndpoints(ctx context.Context, params ListEndpointsParams) ([
 		$3::TEXT IS NULL
 		OR filter_types = '{}'
 		OR filter_types @> ARRAY[$3]
-	)`
-	args := []any{params.SubscriberID, params.Disabled, params.FilterType}
+		OR EXISTS (SELECT 1 FROM unnest(filter_patterns) AS pattern WHERE $3 ~ pattern)
+	)
+	AND ($4::UUID IS NULL OR subscriber_id IN (SELECT id FROM subscribers WHERE application_id = $4))`
+	args := []any{params.SubscriberID, params.Disabled, params.FilterType, s.application}
 
 	rows, err := s.pool.Query(ctx, query, args...)
 	if err != nil {
@@ -111,7 +243,7 @@ func (s Store) ListEndpoints(ctx context.Context, params ListEndpointsParams) ([
 
 	endpoints := make([]*Endpoint, 0)
 	for rows.Next() {
-		endpoint, err := scanEndpoint(rows)
+		endpoint, err := s.scanEndpoint(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -124,51 +256,296 @@ func (s Store) ListEndpoints(ctx context.Context, params ListEndpointsParams) ([
 	return endpoints, nil
 }
 
-func scanEndpoint(row pgx.Row) (*Endpoint, error) {
+// Scans an endpoint row, decrypting its secrets.
+func (s Store) scanEndpoint(row pgx.Row) (*Endpoint, error) {
 	var endpoint Endpoint
+	var retrySchedule []int32
 	err := row.Scan(
-		&endpoint.ID, &endpoint.Label, &endpoint.URL, &endpoint.Secret, &endpoint.Disabled,
-		&endpoint.FilterTypes, &endpoint.SubscriberID, &endpoint.CreatedAt, &endpoint.UpdatedAt,
+		&endpoint.ID, &endpoint.UID, &endpoint.Label, &endpoint.URL, &endpoint.Secret, &endpoint.PreviousSecret,
+		&endpoint.PreviousSecretExpiresAt, &endpoint.Disabled, &endpoint.FilterTypes, &endpoint.VersionPins,
+		&endpoint.SubscriberID, &retrySchedule, &endpoint.MaxInFlight, &endpoint.ConsecutiveFailures,
+		&endpoint.FailingSince, &endpoint.CreatedAt, &endpoint.UpdatedAt,
 	)
 	if err != nil {
 		return nil, err
 	}
+	endpoint.RetrySchedule = secondsToSchedule(retrySchedule)
+
+	endpoint.Secret, err = s.keyring.Decrypt(endpoint.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt endpoint secret: %w", err)
+	}
+	endpoint.PreviousSecret, err = s.keyring.Decrypt(endpoint.PreviousSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt endpoint previous secret: %w", err)
+	}
 	return &endpoint, nil
 }
 
+// Updates the endpoint. Enabling a disabled endpoint resets its failures.
+// Secrets are left untouched, they only change through rotation so a
+// concurrent update can't restore a rotated secret.
 func (s Store) UpdateEndpoint(ctx context.Context, endpoint *Endpoint) error {
 	endpoint.FilterTypes = removeDuplicates(endpoint.FilterTypes)
-
+	endpoint.RetrySchedule = secondsToSchedule(scheduleToSeconds(endpoint.RetrySchedule))
+	if endpoint.VersionPins == nil {
+		endpoint.VersionPins = make(map[string]int)
+	}
+	patterns, err := filterPatterns(endpoint.FilterTypes)
+	if err != nil {
+		return err
+	}
 	query := `
 	UPDATE endpoints SET
+		consecutive_failures = CASE WHEN disabled AND NOT $4 THEN 0 ELSE consecutive_failures END,
+		failing_since = CASE WHEN disabled AND NOT $4 THEN NULL ELSE failing_since END,
 		label = $2,
 		url = $3,
 		disabled = $4,
 		filter_types = $5,
-		secret = $6,
+		retry_schedule = $6,
+		max_in_flight = NULLIF($7, 0),
+		uid = NULLIF($9, ''),
+		version_pins = $10,
+		filter_patterns = $11,
 		updated_at = CURRENT_TIMESTAMP
 	WHERE id = $1
-	RETURNING updated_at`
+	AND ($8::UUID IS NULL OR subscriber_id IN (SELECT id FROM subscribers WHERE application_id = $8))
+	RETURNING consecutive_failures, failing_since, updated_at`
 	args := []any{
 		endpoint.ID,
 		endpoint.Label,
 		endpoint.URL,
 		endpoint.Disabled,
 		endpoint.FilterTypes,
-		endpoint.Secret,
+		scheduleToSeconds(endpoint.RetrySchedule),
+		endpoint.MaxInFlight,
+		s.application,
+		endpoint.UID,
+		endpoint.VersionPins,
+		patterns,
 	}
-	err := s.pool.QueryRow(ctx, query, args...).Scan(&endpoint.UpdatedAt)
+	err = s.pool.QueryRow(ctx, query, args...).Scan(
+		&endpoint.ConsecutiveFailures,
+		&endpoint.FailingSince,
+		&endpoint.UpdatedAt,
+	)
 	if err != nil {
-		return fmt.Errorf("failed to update endpoint: %w", err)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrNotFound
+		case isUniqueViolation(err):
+			return ErrConflict
+		default:
+			return fmt.Errorf("failed to update endpoint: %w", err)
+		}
 	}
 	return nil
 }
 
-func (s Store) DeleteEndpoint(ctx context.Context, endpointID uuid.UUID) error {
-	query := `DELETE FROM endpoints WHERE id = $1`
+// Replaces the endpoint secret, keeping the current one as the previous
+// secret for the overlap duration.
+func (s Store) RotateEndpointSecret(ctx context.Context, endpoint *Endpoint, secret string, overlap time.Duration) error {
+	encrypted, err := s.keyring.Encrypt(secret)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt endpoint secret: %w", err)
+	}
+
+	query := `
+	UPDATE endpoints SET
+		previous_secret = secret,
+		previous_secret_expires_at = CURRENT_TIMESTAMP + make_interval(secs => $3),
+		secret = $2,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	AND ($4::UUID IS NULL OR subscriber_id IN (SELECT id FROM subscribers WHERE application_id = $4))
+	RETURNING previous_secret, previous_secret_expires_at, updated_at`
+
+	var previous string
+	var expiresAt *time.Time
+	var updatedAt time.Time
+	err = s.pool.QueryRow(ctx, query, endpoint.ID, encrypted, overlap.Seconds(), s.application).Scan(
+		&previous,
+		&expiresAt,
+		&updatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrNotFound
+		default:
+			return fmt.Errorf("failed to rotate endpoint secret: %w", err)
+		}
+	}
+	previous, err = s.keyring.Decrypt(previous)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt endpoint previous secret: %w", err)
+	}
+
+	endpoint.Secret = secret
+	endpoint.PreviousSecret = previous
+	endpoint.PreviousSecretExpiresAt = expiresAt
+	endpoint.UpdatedAt = updatedAt
+	return nil
+}
+
+// Clears the failure streak of an endpoint after a successful delivery.
+func (s Store) RecordEndpointSuccess(ctx context.Context, endpointID uuid.UUID) error {
+	query := `
+	UPDATE endpoints SET
+		consecutive_failures = 0,
+		failing_since = NULL
+	WHERE id = $1
+	AND consecutive_failures > 0`
 	_, err := s.pool.Exec(ctx, query, endpointID)
+	if err != nil {
+		return fmt.Errorf("failed to record endpoint success: %w", err)
+	}
+	return nil
+}
+
+// Records a failed delivery to the endpoint and disables it once it has been
+// failing for longer than disableAfter, which is ignored when zero. Reports
+// whether the endpoint was disabled by this call.
+func (s Store) RecordEndpointFailure(ctx context.Context, endpointID uuid.UUID, disableAfter time.Duration) (bool, error) {
+	query := `
+	WITH previous AS (
+		SELECT id, disabled
+		FROM endpoints
+		WHERE id = $1
+		FOR UPDATE
+	)
+	UPDATE endpoints e SET
+		consecutive_failures = e.consecutive_failures + 1,
+		failing_since = COALESCE(e.failing_since, CURRENT_TIMESTAMP),
+		disabled = e.disabled OR COALESCE(
+			$2 > 0 AND e.failing_since <= CURRENT_TIMESTAMP - make_interval(secs => $2),
+			FALSE
+		),
+		updated_at = CURRENT_TIMESTAMP
+	FROM previous p
+	WHERE e.id = p.id
+	RETURNING e.disabled AND NOT p.disabled`
+
+	var disabled bool
+	err := s.pool.QueryRow(ctx, query, endpointID, disableAfter.Seconds()).Scan(&disabled)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return false, ErrNotFound
+		default:
+			return false, fmt.Errorf("failed to record endpoint failure: %w", err)
+		}
+	}
+	return disabled, nil
+}
+
+func (s Store) DeleteEndpoint(ctx context.Context, endpointID uuid.UUID) error {
+	query := `
+	DELETE FROM endpoints
+	WHERE id = $1
+	AND ($2::UUID IS NULL OR subscriber_id IN (SELECT id FROM subscribers WHERE application_id = $2))`
+	_, err := s.pool.Exec(ctx, query, endpointID, s.application)
 	if err != nil {
 		return fmt.Errorf("failed to delete endpoint: %w", err)
 	}
 	return nil
 }
+
+// Encrypts again with the current key the endpoint secrets sealed with an
+// older key or stored in plaintext, batchSize endpoints per transaction.
+// Returns the number of updated endpoints in committed batches, also when
+// a later batch fails.
+func (s *Store) ReencryptEndpointSecrets(ctx context.Context, batchSize int) (int, error) {
+	if s.keyring == nil {
+		return 0, fmt.Errorf("failed to re-encrypt endpoint secrets: no keyring configured")
+	}
+
+	var updated int
+	var cursor uuid.UUID
+	for {
+		// Only counted once the batch commits.
+		var scanned, batchUpdated int
+		err := s.InTx(ctx, func(ctx context.Context, store *Store) error {
+			query := `
+			SELECT id, secret, COALESCE(previous_secret, '')
+			FROM endpoints
+			WHERE id > $1
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE`
+
+			rows, err := store.pool.Query(ctx, query, cursor, batchSize)
+			if err != nil {
+				return fmt.Errorf("failed to list endpoint secrets: %w", err)
+			}
+			type row struct {
+				id       uuid.UUID
+				secret   string
+				previous string
+			}
+			stale, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (row, error) {
+				var v row
+				err := r.Scan(&v.id, &v.secret, &v.previous)
+				return v, err
+			})
+			if err != nil {
+				return fmt.Errorf("failed to scan endpoint secrets: %w", err)
+			}
+			scanned = len(stale)
+			if scanned > 0 {
+				cursor = stale[scanned-1].id
+			}
+
+			for _, v := range stale {
+				if !store.keyring.NeedsReencrypt(v.secret) &&
+					(v.previous == "" || !store.keyring.NeedsReencrypt(v.previous)) {
+					continue
+				}
+
+				secret, err := store.reencrypt(v.secret)
+				if err != nil {
+					return err
+				}
+				previous, err := store.reencrypt(v.previous)
+				if err != nil {
+					return err
+				}
+
+				query := `
+				UPDATE endpoints SET
+					secret = $2,
+					previous_secret = NULLIF($3, '')
+				WHERE id = $1`
+				_, err = store.pool.Exec(ctx, query, v.id, secret, previous)
+				if err != nil {
+					return fmt.Errorf("failed to update endpoint secrets: %w", err)
+				}
+				batchUpdated++
+			}
+			return nil
+		})
+		if err != nil {
+			return updated, err
+		}
+		updated += batchUpdated
+		if scanned < batchSize {
+			return updated, nil
+		}
+	}
+}
+
+func (s Store) reencrypt(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	plaintext, err := s.keyring.Decrypt(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt endpoint secret: %w", err)
+	}
+	encrypted, err := s.keyring.Encrypt(plaintext)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt endpoint secret: %w", err)
+	}
+	return encrypted, nil
+}
@@ -1,10 +1,16 @@
 package database
 
 import (
+	"bytes"
 	"crypto/rand"
 	"errors"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/ffss92/webhookd/internal/filter"
+	"github.com/ffss92/webhookd/internal/keyring"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
 )
@@ -77,6 +83,85 @@ func TestEndpointLifecycle(t *testing.T) {
 	}
 }
 
+func TestEndpointFailures(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	sub := &Subscriber{
+		Name: "test",
+	}
+	err := store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &Endpoint{
+		Label:        "test-endpoint",
+		URL:          "http://endpoint.com",
+		Secret:       rand.Text(),
+		SubscriberID: sub.ID,
+	}
+	err = store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first failure starts the streak, so it can't exceed the threshold.
+	for i, want := range []bool{false, true, false} {
+		disabled, err := store.RecordEndpointFailure(t.Context(), endpoint.ID, time.Nanosecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if disabled != want {
+			t.Fatalf("failure %d: expected disabled to be %t but got %t", i+1, want, disabled)
+		}
+	}
+
+	read, err := store.GetEndpoint(t.Context(), endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !read.Disabled || read.ConsecutiveFailures != 3 || read.FailingSince == nil {
+		t.Fatalf("unexpected failing endpoint: %+v", read)
+	}
+
+	read.Disabled = false
+	err = store.UpdateEndpoint(t.Context(), read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.ConsecutiveFailures != 0 || read.FailingSince != nil {
+		t.Fatalf("expected enabling the endpoint to reset failures: %+v", read)
+	}
+
+	disabled, err := store.RecordEndpointFailure(t.Context(), endpoint.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if disabled {
+		t.Fatal("expected endpoint to not be disabled without a threshold")
+	}
+
+	err = store.RecordEndpointSuccess(t.Context(), endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err = store.GetEndpoint(t.Context(), endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.ConsecutiveFailures != 0 || read.FailingSince != nil {
+		t.Fatalf("expected success to reset failures: %+v", read)
+	}
+
+	_, err = store.RecordEndpointFailure(t.Context(), uuid.New(), time.Hour)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+}
+
 func TestGetEndpoint_NotFound(t *testing.T) {
 	t.Parallel()
 
@@ -89,6 +174,59 @@ func TestGetEndpoint_NotFound(t *testing.T) {
 	}
 }
 
+func TestGetEndpointByUID(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	subs := make([]*Subscriber, 2)
+	for i := range subs {
+		subs[i] = &Subscriber{Name: "test"}
+		err := store.SaveSubscriber(t.Context(), subs[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	endpoint := &Endpoint{
+		UID:          "endpoint_1",
+		Label:        "test",
+		URL:          "https://example.com",
+		Secret:       "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw",
+		SubscriberID: subs[0].ID,
+	}
+	err := store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := store.GetEndpointByUID(t.Context(), endpoint.UID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.ID != endpoint.ID || read.UID != endpoint.UID {
+		t.Fatalf("expected endpoint %s but got %s", endpoint.ID, read.ID)
+	}
+
+	// Uids are unique across the subscribers of an application.
+	err = store.SaveEndpoint(t.Context(), &Endpoint{
+		UID:          endpoint.UID,
+		Label:        "test",
+		URL:          "https://example.com",
+		Secret:       "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw",
+		SubscriberID: subs[1].ID,
+	})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict but got %v", err)
+	}
+
+	_, err = store.GetEndpointByUID(t.Context(), "missing")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+}
+
 func ptr[T any](value T) *T {
 	return &value
 }
@@ -206,3 +344,340 @@ func TestListEndpoints(t *testing.T) {
 		})
 	}
 }
+
+func TestListEndpoints_FilterPatterns(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	sub := &Subscriber{
+		Name: "test",
+	}
+	err := store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filters := map[string][]string{
+		"invoices":        {"invoice.*"},
+		"failures":        {"*.failed"},
+		"nested failures": {"**.failed"},
+		"mixed":           {"customer.updated", "invoice.**"},
+	}
+	for label, filterTypes := range filters {
+		err = store.SaveEndpoint(t.Context(), &Endpoint{
+			Label:        label,
+			URL:          "http://test.com",
+			SubscriberID: sub.ID,
+			FilterTypes:  filterTypes,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		eventType string
+		expected  []string
+	}{
+		{
+			eventType: "invoice.paid",
+			expected:  []string{"invoices", "mixed"},
+		},
+		{
+			eventType: "invoice.failed",
+			expected:  []string{"failures", "invoices", "mixed", "nested failures"},
+		},
+		{
+			eventType: "invoice.payment.failed",
+			expected:  []string{"mixed", "nested failures"},
+		},
+		{
+			eventType: "customer.updated",
+			expected:  []string{"mixed"},
+		},
+		{
+			eventType: "customer.created",
+			expected:  []string{},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.eventType, func(t *testing.T) {
+			t.Parallel()
+
+			endpoints, err := store.ListEndpoints(t.Context(), ListEndpointsParams{
+				SubscriberID: sub.ID,
+				FilterType:   &tt.eventType,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(endpoints))
+			for _, endpoint := range endpoints {
+				got = append(got, endpoint.Label)
+			}
+			slices.Sort(got)
+			if diff := cmp.Diff(tt.expected, got); diff != "" {
+				t.Fatalf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSaveEndpoint_InvalidPattern(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	sub := &Subscriber{
+		Name: "test",
+	}
+	err := store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.SaveEndpoint(t.Context(), &Endpoint{
+		Label:        "test",
+		URL:          "http://test.com",
+		SubscriberID: sub.ID,
+		FilterTypes:  []string{"invoice.pa*"},
+	})
+	if !errors.Is(err, filter.ErrInvalidPattern) {
+		t.Fatalf("expected error %v but got %v", filter.ErrInvalidPattern, err)
+	}
+}
+
+func TestRotateEndpointSecret(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	sub := &Subscriber{
+		Name: "test",
+	}
+	err := store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &Endpoint{
+		Label:        "test-endpoint",
+		URL:          "http://endpoint.com",
+		Secret:       rand.Text(),
+		SubscriberID: sub.ID,
+	}
+	err = store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale := *endpoint
+	previous := endpoint.Secret
+	err = store.RotateEndpointSecret(t.Context(), endpoint, rand.Text(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoint.PreviousSecret != previous || endpoint.PreviousSecretExpiresAt == nil {
+		t.Fatalf("expected previous secret to be kept: %+v", endpoint)
+	}
+
+	// An update read before the rotation must not restore the old secret.
+	err = store.UpdateEndpoint(t.Context(), &stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint.UpdatedAt = stale.UpdatedAt
+
+	read, err := store.GetEndpoint(t.Context(), endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(endpoint, read); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{endpoint.Secret, previous}, read.Secrets(time.Now())); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{endpoint.Secret}, read.Secrets(time.Now().Add(2*time.Hour))); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	err = store.RotateEndpointSecret(t.Context(), &Endpoint{ID: uuid.New()}, rand.Text(), time.Hour)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+}
+
+func TestEndpointSecretEncryption(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+
+	keys := map[string][]byte{
+		"v1": bytes.Repeat([]byte{1}, keyring.KeySize),
+		"v2": bytes.Repeat([]byte{2}, keyring.KeySize),
+	}
+	v1, err := keyring.New(keys, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := keyring.New(keys, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := New(pool)
+	store := New(pool, WithKeyring(v1))
+
+	sub := &Subscriber{
+		Name: "test",
+	}
+	err = store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Written before encryption was enabled.
+	legacy := &Endpoint{
+		Label:        "legacy",
+		URL:          "http://endpoint.com",
+		Secret:       rand.Text(),
+		SubscriberID: sub.ID,
+	}
+	err = plain.SaveEndpoint(t.Context(), legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &Endpoint{
+		Label:        "encrypted",
+		URL:          "http://endpoint.com",
+		Secret:       rand.Text(),
+		SubscriberID: sub.ID,
+	}
+	err = store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawSecret := func(endpointID uuid.UUID) string {
+		t.Helper()
+
+		var secret string
+		err := pool.QueryRow(t.Context(), `SELECT secret FROM endpoints WHERE id = $1`, endpointID).Scan(&secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return secret
+	}
+
+	if raw := rawSecret(endpoint.ID); !keyring.IsEncrypted(raw) || strings.Contains(raw, endpoint.Secret) {
+		t.Fatalf("expected secret to be encrypted at rest but got %q", raw)
+	}
+	for _, want := range []*Endpoint{legacy, endpoint} {
+		read, err := store.GetEndpoint(t.Context(), want.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if read.Secret != want.Secret {
+			t.Fatalf("expected secret %q but got %q", want.Secret, read.Secret)
+		}
+	}
+
+	rotated := New(pool, WithKeyring(v2))
+	updated, err := rotated.ReencryptEndpointSecrets(t.Context(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 2 {
+		t.Fatalf("expected 2 updated endpoints but got %d", updated)
+	}
+	for _, want := range []*Endpoint{legacy, endpoint} {
+		if raw := rawSecret(want.ID); v2.NeedsReencrypt(raw) {
+			t.Fatalf("expected secret to be encrypted with the current key but got %q", raw)
+		}
+		read, err := rotated.GetEndpoint(t.Context(), want.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if read.Secret != want.Secret {
+			t.Fatalf("expected secret %q but got %q", want.Secret, read.Secret)
+		}
+	}
+
+	updated, err = rotated.ReencryptEndpointSecrets(t.Context(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 0 {
+		t.Fatalf("expected no updated endpoints but got %d", updated)
+	}
+}
+
+func TestReencryptEndpointSecrets_FailedBatch(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	plain := New(pool)
+
+	kr, err := keyring.New(map[string][]byte{"v1": bytes.Repeat([]byte{1}, keyring.KeySize)}, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := &Subscriber{
+		Name: "test",
+	}
+	err = plain.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := make([]uuid.UUID, 0, 3)
+	for range 3 {
+		endpoint := &Endpoint{
+			Label:        "test",
+			URL:          "http://endpoint.com",
+			Secret:       rand.Text(),
+			SubscriberID: sub.ID,
+		}
+		err := plain.SaveEndpoint(t.Context(), endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, endpoint.ID)
+	}
+	slices.SortFunc(ids, func(a, b uuid.UUID) int {
+		return bytes.Compare(a[:], b[:])
+	})
+
+	// The last endpoint of the batch can't be decrypted, which rolls back the
+	// ones updated before it.
+	_, err = pool.Exec(t.Context(), `UPDATE endpoints SET secret = 'enc:v9:a:b' WHERE id = $1`, ids[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := New(pool, WithKeyring(kr)).ReencryptEndpointSecrets(t.Context(), 10)
+	if !errors.Is(err, keyring.ErrUnknownVersion) {
+		t.Fatalf("expected error %v but got %v", keyring.ErrUnknownVersion, err)
+	}
+	if updated != 0 {
+		t.Fatalf("expected no updated endpoints but got %d", updated)
+	}
+	for _, id := range ids[:2] {
+		var secret string
+		err := pool.QueryRow(t.Context(), `SELECT secret FROM endpoints WHERE id = $1`, id).Scan(&secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keyring.IsEncrypted(secret) {
+			t.Fatalf("expected secret of %s to be rolled back", id)
+		}
+	}
+}
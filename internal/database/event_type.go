@@ -0,0 +1,360 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// EventType is an entry of the application catalog of message types.
+type EventType struct {
+	ID            uuid.UUID
+	ApplicationID uuid.UUID
+	Name          string
+	Description   string
+	// Current version, which new messages use by default.
+	Version int
+	// JSON Schema of the current version, nil when any payload is accepted.
+	Schema json.RawMessage
+	// Deprecated types are still accepted but should not be used anymore.
+	Deprecated bool
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (s Store) SaveEventType(ctx context.Context, eventType *EventType) error {
+	eventType.ApplicationID = s.applicationFor(eventType.ApplicationID)
+
+	query := `
+	WITH event_type AS (
+		INSERT INTO event_types (application_id, name, description, deprecated)
+		VALUES ($1, $2, $3, $5)
+		RETURNING id, version, created_at, updated_at
+	), first_version AS (
+		INSERT INTO event_type_versions (event_type_id, version, schema)
+		SELECT id, version, $4 FROM event_type
+	)
+	SELECT id, version, created_at, updated_at FROM event_type`
+	args := []any{
+		eventType.ApplicationID,
+		eventType.Name,
+		eventType.Description,
+		eventType.Schema,
+		eventType.Deprecated,
+	}
+
+	err := s.pool.QueryRow(ctx, query, args...).Scan(
+		&eventType.ID,
+		&eventType.Version,
+		&eventType.CreatedAt,
+		&eventType.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err):
+			return ErrConflict
+		default:
+			return fmt.Errorf("failed to save event type: %w", err)
+		}
+	}
+	return nil
+}
+
+// Gets an event type by name. Outside of an application, only event types of
+// the default application are found.
+func (s Store) GetEventType(ctx context.Context, name string) (*EventType, error) {
+	query := `
+	SELECT
+		e.id, e.application_id, e.name, e.description, e.version, v.schema,
+		e.deprecated, e.created_at, e.updated_at
+	FROM event_types e
+	JOIN event_type_versions v ON v.event_type_id = e.id AND v.version = e.version
+	WHERE e.name = $1
+	AND e.application_id = $2`
+
+	eventType, err := scanEventType(s.pool.QueryRow(ctx, query, name, s.applicationFor(uuid.Nil)))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, fmt.Errorf("failed to get event type: %w", err)
+		}
+	}
+	return eventType, nil
+}
+
+// Lists the event types ordered by name.
+func (s Store) ListEventTypes(ctx context.Context) ([]*EventType, error) {
+	query := `
+	SELECT
+		e.id, e.application_id, e.name, e.description, e.version, v.schema,
+		e.deprecated, e.created_at, e.updated_at
+	FROM event_types e
+	JOIN event_type_versions v ON v.event_type_id = e.id AND v.version = e.version
+	WHERE e.application_id = $1
+	ORDER BY e.name`
+
+	rows, err := s.pool.Query(ctx, query, s.applicationFor(uuid.Nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event types: %w", err)
+	}
+	defer rows.Close()
+
+	eventTypes := make([]*EventType, 0)
+	for rows.Next() {
+		eventType, err := scanEventType(rows)
+		if err != nil {
+			return nil, err
+		}
+		eventTypes = append(eventTypes, eventType)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return eventTypes, nil
+}
+
+// Returns the names that are not in the event type catalog, in the order
+// they were given.
+func (s Store) MissingEventTypes(ctx context.Context, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return make([]string, 0), nil
+	}
+
+	query := `
+	SELECT name
+	FROM event_types
+	WHERE application_id = $1
+	AND name = ANY($2)`
+
+	rows, err := s.pool.Query(ctx, query, s.applicationFor(uuid.Nil), names)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check event types: %w", err)
+	}
+	found, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to check event types: %w", err)
+	}
+
+	missing := make([]string, 0)
+	for _, name := range names {
+		if !slices.Contains(found, name) && !slices.Contains(missing, name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+func scanEventType(row pgx.Row) (*EventType, error) {
+	var eventType EventType
+	err := row.Scan(
+		&eventType.ID,
+		&eventType.ApplicationID,
+		&eventType.Name,
+		&eventType.Description,
+		&eventType.Version,
+		&eventType.Schema,
+		&eventType.Deprecated,
+		&eventType.CreatedAt,
+		&eventType.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &eventType, nil
+}
+
+// Updates the description and deprecation of the event type. Schemas change
+// by saving a new version.
+func (s Store) UpdateEventType(ctx context.Context, eventType *EventType) error {
+	query := `
+	UPDATE event_types SET
+		description = $2,
+		deprecated = $3,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	AND ($4::UUID IS NULL OR application_id = $4)
+	RETURNING updated_at`
+	args := []any{
+		eventType.ID,
+		eventType.Description,
+		eventType.Deprecated,
+		s.application,
+	}
+
+	err := s.pool.QueryRow(ctx, query, args...).Scan(&eventType.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrNotFound
+		default:
+			return fmt.Errorf("failed to update event type: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s Store) DeleteEventType(ctx context.Context, eventTypeID uuid.UUID) error {
+	query := `
+	DELETE FROM event_types
+	WHERE id = $1
+	AND ($2::UUID IS NULL OR application_id = $2)`
+	_, err := s.pool.Exec(ctx, query, eventTypeID, s.application)
+	if err != nil {
+		return fmt.Errorf("failed to delete event type: %w", err)
+	}
+	return nil
+}
+
+// Schema of a version of an event type. The transform converts data of the
+// version to the previous one, so messages can be delivered to endpoints
+// pinned to older versions.
+type EventTypeVersion struct {
+	ID          uuid.UUID
+	EventTypeID uuid.UUID
+	Version     int
+	Schema      json.RawMessage
+	Transform   json.RawMessage
+	CreatedAt   time.Time
+}
+
+// Saves version as the next version of eventType, which becomes its current
+// version.
+func (s Store) SaveEventTypeVersion(ctx context.Context, eventType *EventType, version *EventTypeVersion) error {
+	if version.Transform == nil {
+		version.Transform = json.RawMessage(`[]`)
+	}
+
+	query := `
+	WITH event_type AS (
+		UPDATE event_types SET
+			version = version + 1,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		AND ($4::UUID IS NULL OR application_id = $4)
+		RETURNING id, version
+	)
+	INSERT INTO event_type_versions (event_type_id, version, schema, transform)
+	SELECT id, version, $2, $3 FROM event_type
+	RETURNING id, event_type_id, version, created_at`
+	args := []any{eventType.ID, version.Schema, version.Transform, s.application}
+
+	err := s.pool.QueryRow(ctx, query, args...).Scan(
+		&version.ID,
+		&version.EventTypeID,
+		&version.Version,
+		&version.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrNotFound
+		default:
+			return fmt.Errorf("failed to save event type version: %w", err)
+		}
+	}
+	// Both are set to the transaction timestamp.
+	eventType.UpdatedAt = version.CreatedAt
+	eventType.Version = version.Version
+	eventType.Schema = version.Schema
+	return nil
+}
+
+func (s Store) GetEventTypeVersion(ctx context.Context, eventTypeID uuid.UUID, version int) (*EventTypeVersion, error) {
+	query := `
+	SELECT id, event_type_id, version, schema, transform, created_at
+	FROM event_type_versions
+	WHERE event_type_id = $1
+	AND version = $2
+	AND ($3::UUID IS NULL OR event_type_id IN (SELECT id FROM event_types WHERE application_id = $3))`
+
+	eventTypeVersion, err := scanEventTypeVersion(s.pool.QueryRow(ctx, query, eventTypeID, version, s.application))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, fmt.Errorf("failed to get event type version: %w", err)
+		}
+	}
+	return eventTypeVersion, nil
+}
+
+// Lists the versions of an event type, oldest first.
+func (s Store) ListEventTypeVersions(ctx context.Context, eventTypeID uuid.UUID) ([]*EventTypeVersion, error) {
+	query := `
+	SELECT id, event_type_id, version, schema, transform, created_at
+	FROM event_type_versions
+	WHERE event_type_id = $1
+	AND ($2::UUID IS NULL OR event_type_id IN (SELECT id FROM event_types WHERE application_id = $2))
+	ORDER BY version`
+
+	rows, err := s.pool.Query(ctx, query, eventTypeID, s.application)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list event type versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := make([]*EventTypeVersion, 0)
+	for rows.Next() {
+		version, err := scanEventTypeVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+func scanEventTypeVersion(row pgx.Row) (*EventTypeVersion, error) {
+	var version EventTypeVersion
+	err := row.Scan(
+		&version.ID,
+		&version.EventTypeID,
+		&version.Version,
+		&version.Schema,
+		&version.Transform,
+		&version.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// Lists the transforms that convert the data of msg down to the given version,
+// in the order they must be applied.
+func (s Store) ListMessageTransforms(ctx context.Context, msg *Message, version int) ([]json.RawMessage, error) {
+	query := `
+	SELECT v.transform
+	FROM event_type_versions v
+	JOIN event_types e ON e.id = v.event_type_id
+	JOIN subscribers s ON s.application_id = e.application_id
+	WHERE s.id = $1
+	AND e.name = $2
+	AND v.version > $3
+	AND v.version <= $4
+	ORDER BY v.version DESC`
+
+	rows, err := s.pool.Query(ctx, query, msg.SubscriberID, msg.Type, version, msg.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message transforms: %w", err)
+	}
+	transforms, err := pgx.CollectRows(rows, pgx.RowTo[json.RawMessage])
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message transforms: %w", err)
+	}
+	return transforms, nil
+}
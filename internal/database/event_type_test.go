@@ -0,0 +1,203 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+func TestEventTypeLifecycle(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	eventType := &EventType{
+		Name:        "invoice.paid",
+		Description: "An invoice was paid",
+		Schema:      json.RawMessage(`{"type": "object"}`),
+	}
+	err := store.SaveEventType(t.Context(), eventType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.SaveEventType(t.Context(), &EventType{Name: "invoice.paid"})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected error %v but got %v", ErrConflict, err)
+	}
+
+	read, err := store.GetEventType(t.Context(), eventType.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(eventType, read); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	eventType.Deprecated = true
+	err = store.UpdateEventType(t.Context(), eventType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventTypes, err := store.ListEventTypes(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]*EventType{eventType}, eventTypes); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	err = store.DeleteEventType(t.Context(), eventType.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = store.GetEventType(t.Context(), eventType.Name)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected error %v but got %v", ErrNotFound, err)
+	}
+}
+
+func TestMissingEventTypes(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	for _, name := range []string{"invoice.paid", "invoice.voided"} {
+		err := store.SaveEventType(t.Context(), &EventType{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app := &Application{Name: "other"}
+	err := store.SaveApplication(t.Context(), app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name  string
+		store *Store
+		names []string
+		want  []string
+	}{
+		{
+			name:  "all registered",
+			store: store,
+			names: []string{"invoice.paid", "invoice.voided"},
+			want:  []string{},
+		},
+		{
+			name:  "some missing",
+			store: store,
+			names: []string{"invoice.paid", "invoice.created", "invoice.created"},
+			want:  []string{"invoice.created"},
+		},
+		{
+			name:  "other application",
+			store: store.ForApplication(app.ID),
+			names: []string{"invoice.paid"},
+			want:  []string{"invoice.paid"},
+		},
+		{
+			name:  "no names",
+			store: store,
+			names: nil,
+			want:  []string{},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			missing, err := tt.store.MissingEventTypes(t.Context(), tt.names)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, missing); diff != "" {
+				t.Fatalf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEventTypeVersions(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	eventType := &EventType{
+		Name:   "invoice.paid",
+		Schema: json.RawMessage(`{"type": "object"}`),
+	}
+	err := store.SaveEventType(t.Context(), eventType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version := &EventTypeVersion{
+		Schema:    json.RawMessage(`{"required": ["amount"]}`),
+		Transform: json.RawMessage(`[{"op": "remove", "path": "amount"}]`),
+	}
+	err = store.SaveEventTypeVersion(t.Context(), eventType, version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.Version != 2 || eventType.Version != 2 {
+		t.Fatalf("expected version 2 but got %d and %d", version.Version, eventType.Version)
+	}
+
+	read, err := store.GetEventType(t.Context(), eventType.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(eventType, read); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	versions, err := store.ListEventTypeVersions(t.Context(), eventType.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("expected 2 versions but got %d", len(versions))
+	}
+	if diff := cmp.Diff(version, versions[1]); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	first, err := store.GetEventTypeVersion(t.Context(), eventType.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(first.Schema) != `{"type": "object"}` || string(first.Transform) != `[]` {
+		t.Fatalf("unexpected first version %s %s", first.Schema, first.Transform)
+	}
+
+	sub := &Subscriber{Name: "test"}
+	err = store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &Message{Type: eventType.Name, Version: 2, SubscriberID: sub.ID}
+	transforms, err := store.ListMessageTransforms(t.Context(), msg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]json.RawMessage{version.Transform}, transforms); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	err = store.ForApplication(uuid.New()).SaveEventTypeVersion(t.Context(), eventType, &EventTypeVersion{})
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected error %v but got %v", ErrNotFound, err)
+	}
+}
@@ -11,12 +11,26 @@ import (
 	"github.com/jackc/pgx/v5"
 )
 
+// Channel notified on every message insertion, so dispatchers can pick new
+// messages up without waiting for the next poll.
+const MessageChannel = "webhookd_messages"
+
 type Message struct {
-	ID           uuid.UUID
-	Type         string
+	ID   uuid.UUID
+	Type string
+	// Version of the event type schema the data follows, the first one when
+	// zero.
+	Version      int
 	Data         json.RawMessage
 	Tags         []string
 	SubscriberID uuid.UUID
+	// Optional key provided by the producer to deduplicate retried requests,
+	// unique per subscriber.
+	IdempotencyKey string
+	// Hash of the request that created the message, used to detect reuse of
+	// an idempotency key with a different request.
+	RequestHash  string
+	DispatchedAt *time.Time
 	CreatedAt    time.Time
 }
 
@@ -24,33 +38,46 @@ func (s Store) SaveMessage(ctx context.Context, msg *Message) error {
 	if msg.Tags == nil {
 		msg.Tags = make([]string, 0)
 	}
+	if msg.Version == 0 {
+		msg.Version = 1
+	}
+	if err := s.checkSubscriber(ctx, msg.SubscriberID); err != nil {
+		return err
+	}
 
 	query := `
-	INSERT INTO messages (type, data, tags, subscriber_id)
-	VALUES ($1, $2, $3, $4)
+	INSERT INTO messages (type, data, tags, subscriber_id, idempotency_key, request_hash, version)
+	VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7)
 	RETURNING id, created_at`
-	args := []any{msg.Type, msg.Data, msg.Tags, msg.SubscriberID}
+	args := []any{msg.Type, msg.Data, msg.Tags, msg.SubscriberID, msg.IdempotencyKey, msg.RequestHash, msg.Version}
 	err := s.pool.QueryRow(ctx, query, args...).Scan(&msg.ID, &msg.CreatedAt)
 	if err != nil {
-		return fmt.Errorf("failed to save message: %w", err)
+		switch {
+		case isUniqueViolation(err):
+			return ErrConflict
+		default:
+			return fmt.Errorf("failed to save message: %w", err)
+		}
+	}
+
+	// Inside a transaction the notification is only delivered on commit.
+	_, err = s.pool.Exec(ctx, `SELECT pg_notify($1, $2)`, MessageChannel, msg.ID.String())
+	if err != nil {
+		return fmt.Errorf("failed to notify message: %w", err)
 	}
 	return nil
 }
 
 func (s Store) GetMessage(ctx context.Context, msgID uuid.UUID) (*Message, error) {
 	query := `
-	SELECT id, type, data, tags, subscriber_id, created_at
+	SELECT
+		id, type, version, data, tags, subscriber_id, COALESCE(idempotency_key, ''),
+		COALESCE(request_hash, ''), dispatched_at, created_at
 	FROM messages
-	WHERE id = $1`
-	var msg Message
-	err := s.pool.QueryRow(ctx, query, msgID).Scan(
-		&msg.ID,
-		&msg.Type,
-		&msg.Data,
-		&msg.Tags,
-		&msg.SubscriberID,
-		&msg.CreatedAt,
-	)
+	WHERE id = $1
+	AND ($2::UUID IS NULL OR subscriber_id IN (SELECT id FROM subscribers WHERE application_id = $2))`
+
+	msg, err := scanMessage(s.pool.QueryRow(ctx, query, msgID, s.application))
 	if err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
@@ -59,12 +86,113 @@ func (s Store) GetMessage(ctx context.Context, msgID uuid.UUID) (*Message, error
 			return nil, fmt.Errorf("failed to get message: %w", err)
 		}
 	}
+	return msg, nil
+}
+
+func (s Store) GetMessageByIdempotencyKey(ctx context.Context, subID uuid.UUID, key string) (*Message, error) {
+	query := `
+	SELECT
+		id, type, version, data, tags, subscriber_id, COALESCE(idempotency_key, ''),
+		COALESCE(request_hash, ''), dispatched_at, created_at
+	FROM messages
+	WHERE subscriber_id = $1 AND idempotency_key = $2
+	AND ($3::UUID IS NULL OR subscriber_id IN (SELECT id FROM subscribers WHERE application_id = $3))`
+
+	msg, err := scanMessage(s.pool.QueryRow(ctx, query, subID, key, s.application))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, fmt.Errorf("failed to get message: %w", err)
+		}
+	}
+	return msg, nil
+}
+
+// Frees the subscriber idempotency key if it was used before the given time,
+// so it can be reused.
+func (s Store) ReleaseIdempotencyKey(ctx context.Context, subID uuid.UUID, key string, before time.Time) error {
+	query := `
+	UPDATE messages SET idempotency_key = NULL
+	WHERE subscriber_id = $1
+	AND idempotency_key = $2
+	AND created_at < $3
+	AND ($4::UUID IS NULL OR subscriber_id IN (SELECT id FROM subscribers WHERE application_id = $4))`
+
+	_, err := s.pool.Exec(ctx, query, subID, key, before, s.application)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Locks up to limit messages that have not been dispatched yet, oldest first.
+// Messages locked by other transactions are skipped. Must be called inside a
+// transaction.
+func (s Store) ClaimPendingMessages(ctx context.Context, limit int) ([]*Message, error) {
+	query := `
+	SELECT
+		id, type, version, data, tags, subscriber_id, COALESCE(idempotency_key, ''),
+		COALESCE(request_hash, ''), dispatched_at, created_at
+	FROM messages
+	WHERE dispatched_at IS NULL
+	ORDER BY created_at
+	LIMIT $1
+	FOR UPDATE SKIP LOCKED`
+
+	rows, err := s.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim pending messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := make([]*Message, 0)
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func scanMessage(row pgx.Row) (*Message, error) {
+	var msg Message
+	err := row.Scan(
+		&msg.ID, &msg.Type, &msg.Version, &msg.Data, &msg.Tags, &msg.SubscriberID, &msg.IdempotencyKey,
+		&msg.RequestHash, &msg.DispatchedAt, &msg.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
 	return &msg, nil
 }
 
+func (s Store) MarkMessageDispatched(ctx context.Context, msg *Message) error {
+	query := `
+	UPDATE messages SET dispatched_at = CURRENT_TIMESTAMP
+	WHERE id = $1
+	RETURNING dispatched_at`
+
+	err := s.pool.QueryRow(ctx, query, msg.ID).Scan(&msg.DispatchedAt)
+	if err != nil {
+		return fmt.Errorf("failed to mark message as dispatched: %w", err)
+	}
+	return nil
+}
+
 func (s Store) DeleteMessage(ctx context.Context, msgID uuid.UUID) error {
-	query := `DELETE FROM messages WHERE id = $1`
-	_, err := s.pool.Exec(ctx, query, msgID)
+	query := `
+	DELETE FROM messages
+	WHERE id = $1
+	AND ($2::UUID IS NULL OR subscriber_id IN (SELECT id FROM subscribers WHERE application_id = $2))`
+	_, err := s.pool.Exec(ctx, query, msgID, s.application)
 	if err != nil {
 		return fmt.Errorf("failed to delete message: %w", err)
 	}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
@@ -88,3 +89,64 @@ func TestMessageLifecycle(t *testing.T) {
 		})
 	}
 }
+
+func TestMessageIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	sub := &Subscriber{
+		Name: "test",
+	}
+	err := store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatalf("failed to save subscriber: %v", err)
+	}
+
+	msg := &Message{
+		Type:           "test",
+		Data:           json.RawMessage(`{}`),
+		SubscriberID:   sub.ID,
+		IdempotencyKey: "key-1",
+		RequestHash:    "hash",
+	}
+	err = store.SaveMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatalf("failed to save message: %v", err)
+	}
+
+	got, err := store.GetMessageByIdempotencyKey(t.Context(), sub.ID, "key-1")
+	if err != nil {
+		t.Fatalf("failed to get message: %v", err)
+	}
+	if diff := cmp.Diff(msg, got); diff != "" {
+		t.Errorf("message mismatch (-want +got):\n%s", diff)
+	}
+
+	duplicate := &Message{
+		Type:           "test",
+		Data:           json.RawMessage(`{}`),
+		SubscriberID:   sub.ID,
+		IdempotencyKey: "key-1",
+	}
+	err = store.SaveMessage(t.Context(), duplicate)
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict but got %v", err)
+	}
+
+	err = store.ReleaseIdempotencyKey(t.Context(), sub.ID, "key-1", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to release idempotency key: %v", err)
+	}
+
+	_, err = store.GetMessageByIdempotencyKey(t.Context(), sub.ID, "key-1")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected released key to not be found but got %v", err)
+	}
+
+	err = store.SaveMessage(t.Context(), duplicate)
+	if err != nil {
+		t.Fatalf("expected released key to be reusable but got %v", err)
+	}
+}
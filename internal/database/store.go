@@ -5,14 +5,26 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/ffss92/webhookd/internal/keyring"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
 var (
 	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
 )
 
+const (
+	uniqueViolation = "23505"
+)
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
 type DBTX interface {
 	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
 	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
@@ -22,12 +34,79 @@ type DBTX interface {
 
 type Store struct {
 	pool DBTX
+	// Encrypts endpoint secrets at rest, nil stores them in plaintext.
+	keyring *keyring.Keyring
+	// Restricts queries to the data of a single application when set.
+	application *uuid.UUID
 }
 
-func New(pool DBTX) *Store {
-	return &Store{
+type Option func(s *Store)
+
+// Encrypts endpoint secrets with the given keyring.
+func WithKeyring(k *keyring.Keyring) Option {
+	return func(s *Store) {
+		s.keyring = k
+	}
+}
+
+// Restricts the store to the data of the application.
+func WithApplication(appID uuid.UUID) Option {
+	return func(s *Store) {
+		s.application = &appID
+	}
+}
+
+func New(pool DBTX, opts ...Option) *Store {
+	store := &Store{
 		pool: pool,
 	}
+	for _, opt := range opts {
+		opt(store)
+	}
+	return store
+}
+
+// Returns a copy of the store restricted to the data of the application.
+func (s *Store) ForApplication(appID uuid.UUID) *Store {
+	store := *s
+	WithApplication(appID)(&store)
+	return &store
+}
+
+// Application new records are created in: the one the store is restricted
+// to, then the one requested, then the default application.
+func (s Store) applicationFor(requested uuid.UUID) uuid.UUID {
+	switch {
+	case s.application != nil:
+		return *s.application
+	case requested != uuid.Nil:
+		return requested
+	default:
+		return DefaultApplicationID
+	}
+}
+
+// Returns ErrNotFound when the subscriber does not belong to the application
+// the store is restricted to.
+func (s Store) checkSubscriber(ctx context.Context, subID uuid.UUID) error {
+	if s.application == nil {
+		return nil
+	}
+
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM subscribers WHERE id = $1 AND application_id = $2
+	)`
+
+	var exists bool
+	err := s.pool.QueryRow(ctx, query, subID, s.application).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check subscriber: %w", err)
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
 }
 
 func (s *Store) InTx(ctx context.Context, fn func(ctx context.Context, store *Store) error) error {
@@ -36,8 +115,9 @@ func (s *Store) InTx(ctx context.Context, fn func(ctx context.Context, store *St
 		return fmt.Errorf("failed to start tx: %w", err)
 	}
 
-	store := New(tx)
-	if err := fn(ctx, store); err != nil {
+	store := *s
+	store.pool = tx
+	if err := fn(ctx, &store); err != nil {
 		if txErr := tx.Rollback(ctx); txErr != nil {
 			return fmt.Errorf("failed to rollback tx (%v): %w", txErr, err)
 		}
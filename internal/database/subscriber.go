@@ -12,7 +12,10 @@ import (
 )
 
 type Subscriber struct {
-	ID        uuid.UUID
+	ID            uuid.UUID
+	ApplicationID uuid.UUID
+	// Optional identifier chosen by the producer, unique per application.
+	UID       string
 	Name      string
 	Metadata  json.RawMessage
 	CreatedAt time.Time
@@ -23,43 +26,149 @@ func (s Store) SaveSubscriber(ctx context.Context, sub *Subscriber) error {
 	if sub.Metadata == nil {
 		sub.Metadata = json.RawMessage(`null`)
 	}
+	sub.ApplicationID = s.applicationFor(sub.ApplicationID)
 
 	query := `
-	INSERT INTO subscribers (name, metadata)
-	VALUES ($1, $2)
+	INSERT INTO subscribers (application_id, uid, name, metadata)
+	VALUES ($1, NULLIF($2, ''), $3, $4)
 	RETURNING id, created_at, updated_at`
-	args := []any{sub.Name, sub.Metadata}
+	args := []any{sub.ApplicationID, sub.UID, sub.Name, sub.Metadata}
 
 	err := s.pool.QueryRow(ctx, query, args...).Scan(&sub.ID, &sub.CreatedAt, &sub.UpdatedAt)
 	if err != nil {
-		return fmt.Errorf("failed to save subscriber: %w", err)
+		switch {
+		case isUniqueViolation(err):
+			return ErrConflict
+		default:
+			return fmt.Errorf("failed to save subscriber: %w", err)
+		}
 	}
 	return nil
 }
 
 func (s Store) GetSubscriber(ctx context.Context, subID uuid.UUID) (*Subscriber, error) {
 	query := `
-	SELECT id, name, metadata, created_at, updated_at
+	SELECT id, application_id, COALESCE(uid, ''), name, metadata, created_at, updated_at
+	FROM subscribers
+	WHERE id = $1
+	AND ($2::UUID IS NULL OR application_id = $2)`
+
+	subscriber, err := scanSubscriber(s.pool.QueryRow(ctx, query, subID, s.application))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return subscriber, nil
+}
+
+// Gets a subscriber by the uid assigned by the producer. Outside of an
+// application, only subscribers of the default application are found.
+func (s Store) GetSubscriberByUID(ctx context.Context, uid string) (*Subscriber, error) {
+	query := `
+	SELECT id, application_id, COALESCE(uid, ''), name, metadata, created_at, updated_at
 	FROM subscribers
-	WHERE id = $1`
+	WHERE uid = $1
+	AND application_id = $2`
 
+	subscriber, err := scanSubscriber(s.pool.QueryRow(ctx, query, uid, s.applicationFor(uuid.Nil)))
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return subscriber, nil
+}
+
+func scanSubscriber(row pgx.Row) (*Subscriber, error) {
 	var subscriber Subscriber
-	err := s.pool.QueryRow(ctx, query, subID).Scan(
+	err := row.Scan(
 		&subscriber.ID,
+		&subscriber.ApplicationID,
+		&subscriber.UID,
 		&subscriber.Name,
 		&subscriber.Metadata,
 		&subscriber.CreatedAt,
 		&subscriber.UpdatedAt,
 	)
 	if err != nil {
-		switch {
-		case errors.Is(err, pgx.ErrNoRows):
-			return nil, ErrNotFound
-		default:
+		return nil, err
+	}
+	return &subscriber, nil
+}
+
+// Position of a subscriber in the listing order, used as a pagination cursor.
+type SubscriberCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+type ListSubscribersParams struct {
+	// Lists the subscribers after this one, from the start when nil.
+	After *SubscriberCursor
+	// Case insensitive name prefix, ignored when empty.
+	NamePrefix string
+	// JSON object the metadata must contain, ignored when nil.
+	Metadata json.RawMessage
+	// Restricts the listing to a single subscriber when set.
+	SubscriberID *uuid.UUID
+	Limit        int
+}
+
+// Lists subscribers ordered by creation.
+func (s Store) ListSubscribers(ctx context.Context, params ListSubscribersParams) ([]*Subscriber, error) {
+	query := `
+	SELECT id, application_id, COALESCE(uid, ''), name, metadata, created_at, updated_at
+	FROM subscribers
+	WHERE ($1::TIMESTAMPTZ IS NULL OR (created_at, id) > ($1, $2))
+	AND ($3 = '' OR starts_with(lower(name), lower($3)))
+	AND ($4::JSONB IS NULL OR metadata @> $4)
+	AND (id = $5 OR $5 IS NULL)
+	AND ($7::UUID IS NULL OR application_id = $7)
+	ORDER BY created_at, id
+	LIMIT $6`
+
+	var afterCreatedAt *time.Time
+	var afterID uuid.UUID
+	if params.After != nil {
+		afterCreatedAt = &params.After.CreatedAt
+		afterID = params.After.ID
+	}
+	args := []any{
+		afterCreatedAt,
+		afterID,
+		params.NamePrefix,
+		params.Metadata,
+		params.SubscriberID,
+		params.Limit,
+		s.application,
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscribers: %w", err)
+	}
+	defer rows.Close()
+
+	subscribers := make([]*Subscriber, 0)
+	for rows.Next() {
+		subscriber, err := scanSubscriber(rows)
+		if err != nil {
 			return nil, err
 		}
+		subscribers = append(subscribers, subscriber)
 	}
-	return &subscriber, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subscribers, nil
 }
 
 func (s Store) UpdateSubscriber(ctx context.Context, subscriber *Subscriber) error {
@@ -67,21 +176,33 @@ func (s Store) UpdateSubscriber(ctx context.Context, subscriber *Subscriber) err
 	UPDATE subscribers SET
 		name = $2,
 		metadata = $3,
+		uid = NULLIF($5, ''),
 		updated_at = CURRENT_TIMESTAMP
 	WHERE id = $1
+	AND ($4::UUID IS NULL OR application_id = $4)
 	RETURNING updated_at`
-	args := []any{subscriber.ID, subscriber.Name, subscriber.Metadata}
+	args := []any{subscriber.ID, subscriber.Name, subscriber.Metadata, s.application, subscriber.UID}
 
 	err := s.pool.QueryRow(ctx, query, args...).Scan(&subscriber.UpdatedAt)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return ErrNotFound
+		case isUniqueViolation(err):
+			return ErrConflict
+		default:
+			return fmt.Errorf("failed to update subscriber: %w", err)
+		}
 	}
 	return nil
 }
 
 func (s Store) DeleteSubscriber(ctx context.Context, subID uuid.UUID) error {
-	query := `DELETE FROM subscribers WHERE id = $1`
-	_, err := s.pool.Exec(ctx, query, subID)
+	query := `
+	DELETE FROM subscribers
+	WHERE id = $1
+	AND ($2::UUID IS NULL OR application_id = $2)`
+	_, err := s.pool.Exec(ctx, query, subID, s.application)
 	if err != nil {
 		return fmt.Errorf("failed to delete subscriber: %w", err)
 	}
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"encoding/json"
 	"errors"
 	"testing"
 
@@ -66,3 +67,133 @@ func TestGetSubscriber_NotFound(t *testing.T) {
 		t.Fatalf("expected ErrNotFound but got %v", err)
 	}
 }
+
+func TestListSubscribers(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	subs := []*Subscriber{
+		{Name: "Acme", Metadata: json.RawMessage(`{"plan": "pro", "region": "eu"}`)},
+		{Name: "acme labs", Metadata: json.RawMessage(`{"plan": "free"}`)},
+		{Name: "Globex", Metadata: json.RawMessage(`{"plan": "pro"}`)},
+	}
+	for _, sub := range subs {
+		err := store.SaveSubscriber(t.Context(), sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names := func(subscribers []*Subscriber) []string {
+		names := make([]string, 0, len(subscribers))
+		for _, sub := range subscribers {
+			names = append(names, sub.Name)
+		}
+		return names
+	}
+
+	testCases := []struct {
+		name   string
+		params ListSubscribersParams
+		want   []string
+	}{
+		{
+			name:   "all",
+			params: ListSubscribersParams{Limit: 10},
+			want:   []string{"Acme", "acme labs", "Globex"},
+		},
+		{
+			name:   "limit",
+			params: ListSubscribersParams{Limit: 2},
+			want:   []string{"Acme", "acme labs"},
+		},
+		{
+			name: "after cursor",
+			params: ListSubscribersParams{
+				After: &SubscriberCursor{CreatedAt: subs[0].CreatedAt, ID: subs[0].ID},
+				Limit: 10,
+			},
+			want: []string{"acme labs", "Globex"},
+		},
+		{
+			name:   "name prefix",
+			params: ListSubscribersParams{NamePrefix: "ACME", Limit: 10},
+			want:   []string{"Acme", "acme labs"},
+		},
+		{
+			name:   "metadata",
+			params: ListSubscribersParams{Metadata: json.RawMessage(`{"plan": "pro"}`), Limit: 10},
+			want:   []string{"Acme", "Globex"},
+		},
+		{
+			name:   "subscriber",
+			params: ListSubscribersParams{SubscriberID: &subs[2].ID, Limit: 10},
+			want:   []string{"Globex"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.ListSubscribers(t.Context(), tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, names(got)); diff != "" {
+				t.Fatalf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGetSubscriberByUID(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	store := New(pool)
+
+	app := &Application{Name: "test"}
+	err := store.SaveApplication(t.Context(), app)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := &Subscriber{Name: "test", UID: "cust_123"}
+	err = store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := store.GetSubscriberByUID(t.Context(), sub.UID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(sub, read); diff != "" {
+		t.Fatalf("mismatch (-want, +got):\n%s", diff)
+	}
+
+	err = store.SaveSubscriber(t.Context(), &Subscriber{Name: "test", UID: sub.UID})
+	if !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected ErrConflict but got %v", err)
+	}
+
+	// Uids are unique per application.
+	scoped := store.ForApplication(app.ID)
+	_, err = scoped.GetSubscriberByUID(t.Context(), sub.UID)
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound but got %v", err)
+	}
+	other := &Subscriber{Name: "test", UID: sub.UID}
+	err = scoped.SaveSubscriber(t.Context(), other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err = scoped.GetSubscriberByUID(t.Context(), sub.UID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.ID != other.ID {
+		t.Fatalf("expected subscriber %s but got %s", other.ID, read.ID)
+	}
+}
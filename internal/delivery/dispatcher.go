@@ -0,0 +1,322 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/config"
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/retry"
+	"github.com/ffss92/webhookd/internal/transform"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type DispatcherConfig struct {
+	Config *config.Config
+	Logger *slog.Logger
+	Pool   *pgxpool.Pool
+	// Optional, receives operational events such as disabled endpoints, which
+	// are always logged.
+	OnEvent EventHandler
+}
+
+type Dispatcher struct {
+	cfg    *config.Config
+	logger *slog.Logger
+	pool   *pgxpool.Pool
+	store  *database.Store
+	sender *Sender
+	policy retry.Policy
+	// May be nil.
+	onEvent EventHandler
+
+	// Worker pool, each delivery in progress holds a slot.
+	slots    chan struct{}
+	inFlight sync.WaitGroup
+	// Signals that there may be work to do.
+	wake chan struct{}
+}
+
+func NewDispatcher(dcfg DispatcherConfig) (*Dispatcher, error) {
+	if dcfg.Config == nil {
+		return nil, fmt.Errorf("missing config in dispatcher config")
+	}
+	if dcfg.Pool == nil {
+		return nil, fmt.Errorf("missing db pool in dispatcher config")
+	}
+	if dcfg.Logger == nil {
+		return nil, fmt.Errorf("missing logger in dispatcher config")
+	}
+
+	kr, err := dcfg.Config.Keyring()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keyring: %w", err)
+	}
+
+	return &Dispatcher{
+		cfg:     dcfg.Config,
+		logger:  dcfg.Logger,
+		pool:    dcfg.Pool,
+		store:   database.New(dcfg.Pool, database.WithKeyring(kr)),
+		sender:  NewSender(dcfg.Config.DeliveryTimeout, dcfg.Config.DeliveryAllowPrivate),
+		policy:  dcfg.Config.RetryPolicy(),
+		onEvent: dcfg.OnEvent,
+		slots:   make(chan struct{}, dcfg.Config.DispatcherWorkers),
+		wake:    make(chan struct{}, 1),
+	}, nil
+}
+
+// Runs the dispatcher until ctx is cancelled. Pending messages and due
+// deliveries are processed as soon as a message is inserted or a worker is
+// freed, and every DispatcherPollInterval, which also covers retries and lost
+// notifications. Deliveries in progress are awaited before returning.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.cfg.DispatcherPollInterval)
+	defer ticker.Stop()
+	defer d.inFlight.Wait()
+
+	go d.listen(ctx, d.wake)
+
+	for {
+		if err := d.dispatchPending(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			d.logger.Error("failed to dispatch pending messages", slog.String("err", err.Error()))
+		}
+		if err := d.deliverDue(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			d.logger.Error("failed to deliver due messages", slog.String("err", err.Error()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) dispatchPending(ctx context.Context) error {
+	for {
+		var count int
+		err := d.store.InTx(ctx, func(ctx context.Context, store *database.Store) error {
+			messages, err := store.ClaimPendingMessages(ctx, d.cfg.DispatcherBatchSize)
+			if err != nil {
+				return err
+			}
+			count = len(messages)
+
+			for _, msg := range messages {
+				if _, err := store.EnqueueMessage(ctx, msg); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if count < d.cfg.DispatcherBatchSize {
+			return nil
+		}
+	}
+}
+
+// Claims due deliveries while there are free workers and hands each of them
+// to a worker. It does not wait for the deliveries to complete, which outlive
+// ctx until their lease runs out.
+func (d *Dispatcher) deliverDue(ctx context.Context) error {
+	for {
+		free := cap(d.slots) - len(d.slots)
+		if free == 0 {
+			return nil
+		}
+
+		var deliveries []*database.Delivery
+		err := d.store.InTx(ctx, func(ctx context.Context, store *database.Store) error {
+			var err error
+			deliveries, err = store.ClaimDeliveries(ctx, database.ClaimDeliveriesParams{
+				Limit:       min(free, d.cfg.DispatcherBatchSize),
+				Lease:       d.leaseDuration(),
+				MaxInFlight: d.cfg.EndpointMaxInFlight,
+			})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range deliveries {
+			// Only this goroutine acquires slots, so this never blocks.
+			d.slots <- struct{}{}
+			d.inFlight.Add(1)
+			go func() {
+				defer func() {
+					<-d.slots
+					d.inFlight.Done()
+					notify(d.wake)
+				}()
+
+				// Detached from ctx so shutting down lets requests in flight
+				// finish and record their result instead of failing them.
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), d.leaseDuration())
+				defer cancel()
+
+				if err := d.deliver(ctx, delivery); err != nil {
+					d.logger.Error(
+						"failed to process delivery",
+						slog.String("delivery_id", delivery.ID.String()),
+						slog.String("err", err.Error()),
+					)
+				}
+			}()
+		}
+
+		if len(deliveries) < min(free, d.cfg.DispatcherBatchSize) {
+			return nil
+		}
+	}
+}
+
+// Claimed deliveries are locked long enough for the request to time out and
+// the result to be recorded.
+func (d *Dispatcher) leaseDuration() time.Duration {
+	return d.cfg.DeliveryTimeout + time.Minute
+}
+
+// Reported by attempts whose message couldn't be converted to the version the
+// endpoint is pinned to. The endpoint isn't contacted and retrying would fail
+// the same way.
+var errConversion = errors.New("failed to convert message")
+
+// Sends msg to endpoint, down-converted to the version of its type the
+// endpoint is pinned to. Data that can't be converted fails the attempt with
+// errConversion.
+func (d *Dispatcher) send(ctx context.Context, endpoint *database.Endpoint, msg *database.Message) (Result, error) {
+	version, ok := endpoint.VersionPins[msg.Type]
+	if !ok || version >= msg.Version {
+		return d.sender.Send(ctx, endpoint, msg), nil
+	}
+
+	transforms, err := d.store.ListMessageTransforms(ctx, msg, version)
+	if err != nil {
+		return Result{}, err
+	}
+
+	converted := *msg
+	for _, raw := range transforms {
+		t, err := transform.Parse(raw)
+		if err == nil {
+			converted.Data, err = t.Apply(converted.Data)
+		}
+		if err != nil {
+			return Result{Err: fmt.Errorf("%w to version %d: %w", errConversion, version, err)}, nil
+		}
+	}
+	return d.sender.Send(ctx, endpoint, &converted), nil
+}
+
+// Makes the next attempt of delivery, records it and schedules a retry
+// according to the endpoint retry policy when it fails. Messages that can't be
+// converted for the endpoint fail the delivery without retries.
+func (d *Dispatcher) deliver(ctx context.Context, delivery *database.Delivery) error {
+	endpoint, err := d.store.GetEndpoint(ctx, delivery.EndpointID)
+	if err != nil {
+		return fmt.Errorf("failed to get endpoint: %w", err)
+	}
+	msg, err := d.store.GetMessage(ctx, delivery.MessageID)
+	if err != nil {
+		return fmt.Errorf("failed to get message: %w", err)
+	}
+
+	res, err := d.send(ctx, endpoint, msg)
+	if err != nil {
+		return err
+	}
+
+	attempt := &database.Attempt{
+		MessageID:       msg.ID,
+		EndpointID:      endpoint.ID,
+		StatusCode:      res.StatusCode,
+		ResponseHeaders: res.Header,
+		ResponseBody:    res.Body,
+		Latency:         res.Latency,
+	}
+	if res.Err != nil {
+		attempt.Error = res.Err.Error()
+	}
+	if err := d.store.SaveAttempt(ctx, attempt); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.NextAttemptAt = nil
+
+	switch {
+	case res.Err == nil:
+		delivery.Status = database.DeliverySucceeded
+		if endpoint.ConsecutiveFailures > 0 {
+			if err := d.store.RecordEndpointSuccess(ctx, endpoint.ID); err != nil {
+				return err
+			}
+		}
+	case errors.Is(res.Err, errConversion):
+		// The producer transform is at fault, so the endpoint health is left
+		// untouched.
+		delivery.Status = database.DeliveryFailed
+		d.logger.Warn(
+			"failed to convert message",
+			slog.String("message_id", msg.ID.String()),
+			slog.String("endpoint_id", endpoint.ID.String()),
+			slog.String("err", res.Err.Error()),
+		)
+	default:
+		schedule := endpoint.RetrySchedule
+		if len(schedule) == 0 {
+			app, err := d.store.GetSubscriberApplication(ctx, endpoint.SubscriberID)
+			if err != nil {
+				return err
+			}
+			schedule = app.RetrySchedule
+		}
+		policy := d.policy.WithSchedule(schedule)
+		delay, ok := policy.NextDelay(delivery.Attempts)
+		if ok {
+			next := now.Add(delay)
+			delivery.NextAttemptAt = &next
+		} else {
+			delivery.Status = database.DeliveryFailed
+		}
+
+		d.logger.Warn(
+			"failed to deliver message",
+			slog.String("message_id", msg.ID.String()),
+			slog.String("endpoint_id", endpoint.ID.String()),
+			slog.Int("attempt", attempt.Attempt),
+			slog.Int("status", res.StatusCode),
+			slog.Bool("retry", ok),
+			slog.String("err", res.Err.Error()),
+		)
+
+		disabled, err := d.store.RecordEndpointFailure(ctx, endpoint.ID, d.cfg.EndpointDisableAfter)
+		if err != nil {
+			return err
+		}
+		if disabled {
+			d.emit(ctx, Event{
+				Type:         EventEndpointDisabled,
+				EndpointID:   endpoint.ID,
+				SubscriberID: endpoint.SubscriberID,
+				Reason:       fmt.Sprintf("failing for more than %s", d.cfg.EndpointDisableAfter),
+				CreatedAt:    now,
+			})
+		}
+	}
+
+	return d.store.UpdateDelivery(ctx, delivery)
+}
@@ -0,0 +1,779 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/config"
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/keyring"
+	"github.com/ffss92/webhookd/internal/postgres"
+	"github.com/ffss92/webhookd/internal/retry"
+	"github.com/ffss92/webhookd/internal/webhook"
+	"github.com/ffss92/webhookd/webhook/verify"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+)
+
+var (
+	testDB *postgres.TestInstance
+)
+
+func TestMain(m *testing.M) {
+	testDB = postgres.MustTestInstance()
+	defer func() {
+		if err := testDB.Close(); err != nil {
+			log.Fatal(err)
+		}
+	}()
+	m.Run()
+}
+
+func newTestDispatcher(t *testing.T) *Dispatcher {
+	t.Helper()
+
+	pool := testDB.NewPool(t)
+	return &Dispatcher{
+		cfg: &config.Config{
+			DispatcherBatchSize: 10,
+			EndpointMaxInFlight: 5,
+		},
+		logger: slog.New(slog.DiscardHandler),
+		pool:   pool,
+		store:  database.New(pool),
+		sender: NewSender(time.Second, true),
+		policy: retry.Policy{
+			Schedule: []time.Duration{0, time.Hour},
+		},
+		slots: make(chan struct{}, 4),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+func TestDispatchPending(t *testing.T) {
+	t.Parallel()
+
+	d := newTestDispatcher(t)
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sub := &database.Subscriber{Name: "test"}
+	err := d.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints := []*database.Endpoint{
+		{
+			Label:        "match",
+			URL:          srv.URL,
+			Secret:       webhook.NewSecret(),
+			SubscriberID: sub.ID,
+			FilterTypes:  []string{"test.created"},
+		},
+		{
+			Label:        "match all",
+			URL:          srv.URL,
+			Secret:       webhook.NewSecret(),
+			SubscriberID: sub.ID,
+		},
+		{
+			Label:        "other type",
+			URL:          srv.URL,
+			Secret:       webhook.NewSecret(),
+			SubscriberID: sub.ID,
+			FilterTypes:  []string{"test.deleted"},
+		},
+		{
+			Label:        "disabled",
+			URL:          srv.URL,
+			Secret:       webhook.NewSecret(),
+			SubscriberID: sub.ID,
+			Disabled:     true,
+		},
+	}
+	for _, endpoint := range endpoints {
+		err := d.store.SaveEndpoint(t.Context(), endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg := &database.Message{
+		Type:         "test.created",
+		Data:         json.RawMessage(`{"key":"value"}`),
+		SubscriberID: sub.ID,
+	}
+	err = d.store.SaveMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.dispatchPending(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.deliverDue(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.inFlight.Wait()
+
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("expected 2 deliveries but got %d", got)
+	}
+
+	read, err := d.store.GetMessage(t.Context(), msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.DispatchedAt == nil {
+		t.Fatal("expected message to be marked as dispatched")
+	}
+
+	err = d.dispatchPending(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.deliverDue(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.inFlight.Wait()
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("expected dispatched message to not be sent again but got %d deliveries", got)
+	}
+
+	attempts, err := d.store.ListAttempts(t.Context(), database.ListAttemptsParams{
+		MessageID: &msg.ID,
+		Limit:     10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("expected 2 attempts to be recorded but got %d", len(attempts))
+	}
+	for _, attempt := range attempts {
+		if attempt.StatusCode != http.StatusNoContent {
+			t.Fatalf("expected attempt status %d but got %d", http.StatusNoContent, attempt.StatusCode)
+		}
+	}
+}
+
+func TestNewDispatcher_EncryptedSecrets(t *testing.T) {
+	t.Parallel()
+
+	pool := testDB.NewPool(t)
+	cfg := &config.Config{
+		DispatcherBatchSize:  10,
+		DispatcherWorkers:    1,
+		DeliveryTimeout:      time.Second,
+		DeliveryAllowPrivate: true,
+		EndpointMaxInFlight:  5,
+		RetrySchedule:        []time.Duration{0, time.Hour},
+		SecretKeys: map[string]string{
+			"v1": base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, keyring.KeySize)),
+		},
+		SecretKeyVersion: "v1",
+	}
+	d, err := NewDispatcher(DispatcherConfig{
+		Config: cfg,
+		Logger: slog.New(slog.DiscardHandler),
+		Pool:   pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	secret := webhook.NewSecret()
+	verifier, err := verify.New(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err == nil {
+			err = verifier.Verify(r.Header, body)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	// Secrets are stored encrypted, like the API does.
+	kr, err := cfg.Keyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := database.New(pool, database.WithKeyring(kr))
+
+	sub := &database.Subscriber{Name: "test"}
+	err = store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := &database.Endpoint{
+		Label:        "test",
+		URL:          srv.URL,
+		Secret:       secret,
+		SubscriberID: sub.ID,
+	}
+	err = store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &database.Message{
+		Type:         "test.created",
+		Data:         json.RawMessage(`{}`),
+		SubscriberID: sub.ID,
+	}
+	err = store.SaveMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.dispatchPending(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.deliverDue(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.inFlight.Wait()
+
+	delivery, err := store.GetDelivery(t.Context(), msg.ID, endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != database.DeliverySucceeded {
+		t.Fatalf("expected delivery status %q but got %q", database.DeliverySucceeded, delivery.Status)
+	}
+}
+
+func TestDeliverDue_Retry(t *testing.T) {
+	t.Parallel()
+
+	d := newTestDispatcher(t)
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	testCases := []struct {
+		name          string
+		appSchedule   []time.Duration
+		retrySchedule []time.Duration
+		status        database.DeliveryStatus
+	}{
+		{
+			name:   "default policy",
+			status: database.DeliveryPending,
+		},
+		{
+			name:        "application policy",
+			appSchedule: []time.Duration{0},
+			status:      database.DeliveryFailed,
+		},
+		{
+			name:          "endpoint policy",
+			appSchedule:   []time.Duration{0, time.Minute, time.Minute},
+			retrySchedule: []time.Duration{0},
+			status:        database.DeliveryFailed,
+		},
+	}
+
+	for _, tt := range testCases {
+		app := &database.Application{Name: tt.name, RetrySchedule: tt.appSchedule}
+		err := d.store.SaveApplication(t.Context(), app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub := &database.Subscriber{Name: "test", ApplicationID: app.ID}
+		err = d.store.SaveSubscriber(t.Context(), sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		endpoint := &database.Endpoint{
+			Label:         tt.name,
+			URL:           srv.URL,
+			Secret:        webhook.NewSecret(),
+			SubscriberID:  sub.ID,
+			RetrySchedule: tt.retrySchedule,
+		}
+		err = d.store.SaveEndpoint(t.Context(), endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg := &database.Message{
+			Type:         "test.created",
+			Data:         json.RawMessage(`{}`),
+			SubscriberID: sub.ID,
+		}
+		err = d.store.SaveMessage(t.Context(), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = d.store.SaveDeliveries(t.Context(), msg.ID, []uuid.UUID{endpoint.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = d.deliverDue(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.inFlight.Wait()
+
+		delivery, err := d.store.GetDelivery(t.Context(), msg.ID, endpoint.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if delivery.Status != tt.status {
+			t.Fatalf("%s: expected delivery status %q but got %q", tt.name, tt.status, delivery.Status)
+		}
+		if delivery.Attempts != 1 {
+			t.Fatalf("%s: expected 1 attempt but got %d", tt.name, delivery.Attempts)
+		}
+		if tt.status == database.DeliveryPending {
+			if delivery.NextAttemptAt == nil || time.Until(*delivery.NextAttemptAt) < 59*time.Minute {
+				t.Fatalf("%s: expected next attempt to be scheduled in 1h but got %v", tt.name, delivery.NextAttemptAt)
+			}
+		}
+	}
+
+	if got := hits.Load(); got != 3 {
+		t.Fatalf("expected 3 deliveries but got %d", got)
+	}
+}
+
+func TestDeliverDue_VersionPins(t *testing.T) {
+	t.Parallel()
+
+	d := newTestDispatcher(t)
+
+	var mu sync.Mutex
+	bodies := make(map[string]json.RawMessage)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload Payload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		bodies[r.URL.Path] = payload.Data
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sub := &database.Subscriber{Name: "test"}
+	err := d.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventType := &database.EventType{Name: "test.created"}
+	err = d.store.SaveEventType(t.Context(), eventType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transforms := []string{
+		`[{"op": "rename", "from": "customer.email", "path": "email"}, {"op": "remove", "path": "customer"}]`,
+		`[{"op": "remove", "path": "currency"}]`,
+	}
+	for _, transform := range transforms {
+		err = d.store.SaveEventTypeVersion(t.Context(), eventType, &database.EventTypeVersion{
+			Transform: json.RawMessage(transform),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name string
+		pins map[string]int
+		want string
+	}{
+		{
+			name: "latest",
+			want: `{"currency":"usd","customer":{"email":"jane@example.com"}}`,
+		},
+		{
+			name: "previous version",
+			pins: map[string]int{"test.created": 2},
+			want: `{"customer":{"email":"jane@example.com"}}`,
+		},
+		{
+			name: "first version",
+			pins: map[string]int{"test.created": 1},
+			want: `{"email":"jane@example.com"}`,
+		},
+		{
+			name: "other type",
+			pins: map[string]int{"test.deleted": 1},
+			want: `{"currency":"usd","customer":{"email":"jane@example.com"}}`,
+		},
+	}
+
+	endpoints := make([]uuid.UUID, 0, len(testCases))
+	for i, tt := range testCases {
+		endpoint := &database.Endpoint{
+			Label:        tt.name,
+			URL:          fmt.Sprintf("%s/%d", srv.URL, i),
+			Secret:       webhook.NewSecret(),
+			SubscriberID: sub.ID,
+			VersionPins:  tt.pins,
+		}
+		err = d.store.SaveEndpoint(t.Context(), endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		endpoints = append(endpoints, endpoint.ID)
+	}
+
+	msg := &database.Message{
+		Type:         "test.created",
+		Version:      3,
+		Data:         json.RawMessage(`{"currency": "usd", "customer": {"email": "jane@example.com"}}`),
+		SubscriberID: sub.ID,
+	}
+	err = d.store.SaveMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.store.SaveDeliveries(t.Context(), msg.ID, endpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.deliverDue(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.inFlight.Wait()
+
+	for i, tt := range testCases {
+		var got, want any
+		if err := json.Unmarshal(bodies[fmt.Sprintf("/%d", i)], &got); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("%s: mismatch (-want, +got):\n%s", tt.name, diff)
+		}
+	}
+}
+
+func TestDeliverDue_Shutdown(t *testing.T) {
+	t.Parallel()
+
+	d := newTestDispatcher(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sub := &database.Subscriber{Name: "test"}
+	err := d.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &database.Endpoint{
+		Label:        "test",
+		URL:          srv.URL,
+		Secret:       webhook.NewSecret(),
+		SubscriberID: sub.ID,
+	}
+	err = d.store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &database.Message{
+		Type:         "test.created",
+		Data:         json.RawMessage(`{}`),
+		SubscriberID: sub.ID,
+	}
+	err = d.store.SaveMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.store.SaveDeliveries(t.Context(), msg.ID, []uuid.UUID{endpoint.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Shutting down while the request is in flight must not fail it.
+	ctx, cancel := context.WithCancel(t.Context())
+	err = d.deliverDue(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	cancel()
+	close(release)
+	d.inFlight.Wait()
+
+	delivery, err := d.store.GetDelivery(t.Context(), msg.ID, endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != database.DeliverySucceeded {
+		t.Fatalf("expected delivery status %q but got %q", database.DeliverySucceeded, delivery.Status)
+	}
+	if delivery.LockedUntil != nil {
+		t.Fatalf("expected delivery to be unlocked but got %v", delivery.LockedUntil)
+	}
+}
+
+func TestDeliverDue_ConversionFailure(t *testing.T) {
+	t.Parallel()
+
+	d := newTestDispatcher(t)
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	sub := &database.Subscriber{Name: "test"}
+	err := d.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eventType := &database.EventType{Name: "test.created"}
+	err = d.store.SaveEventType(t.Context(), eventType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.store.SaveEventTypeVersion(t.Context(), eventType, &database.EventTypeVersion{
+		Transform: json.RawMessage(`[{"op": "set", "path": "id.value", "value": 1}]`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &database.Endpoint{
+		Label:        "test",
+		URL:          srv.URL,
+		Secret:       webhook.NewSecret(),
+		SubscriberID: sub.ID,
+		VersionPins:  map[string]int{"test.created": 1},
+	}
+	err = d.store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &database.Message{
+		Type:         "test.created",
+		Version:      2,
+		Data:         json.RawMessage(`{"id": "inv_1"}`),
+		SubscriberID: sub.ID,
+	}
+	err = d.store.SaveMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.store.SaveDeliveries(t.Context(), msg.ID, []uuid.UUID{endpoint.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.deliverDue(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.inFlight.Wait()
+
+	if got := hits.Load(); got != 0 {
+		t.Fatalf("expected endpoint to not be contacted but got %d deliveries", got)
+	}
+
+	delivery, err := d.store.GetDelivery(t.Context(), msg.ID, endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != database.DeliveryFailed {
+		t.Fatalf("expected delivery status %q but got %q", database.DeliveryFailed, delivery.Status)
+	}
+	if delivery.NextAttemptAt != nil {
+		t.Fatalf("expected no retry but got %v", delivery.NextAttemptAt)
+	}
+
+	attempts, err := d.store.ListAttempts(t.Context(), database.ListAttemptsParams{
+		MessageID: &msg.ID,
+		Limit:     10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 1 || attempts[0].Error == "" {
+		t.Fatalf("expected 1 attempt with an error but got %d", len(attempts))
+	}
+
+	read, err := d.store.GetEndpoint(t.Context(), endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.ConsecutiveFailures != 0 || read.FailingSince != nil {
+		t.Fatalf("expected endpoint health to be unchanged but got %d failures", read.ConsecutiveFailures)
+	}
+}
+
+func TestDeliverDue_DisableEndpoint(t *testing.T) {
+	t.Parallel()
+
+	d := newTestDispatcher(t)
+	d.cfg.EndpointDisableAfter = time.Nanosecond
+
+	events := make(chan Event, 1)
+	d.onEvent = func(ctx context.Context, event Event) {
+		events <- event
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	sub := &database.Subscriber{Name: "test"}
+	err := d.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint := &database.Endpoint{
+		Label:        "test",
+		URL:          srv.URL,
+		Secret:       webhook.NewSecret(),
+		SubscriberID: sub.ID,
+	}
+	err = d.store.SaveEndpoint(t.Context(), endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Start the failure streak.
+	_, err = d.store.RecordEndpointFailure(t.Context(), endpoint.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &database.Message{
+		Type:         "test.created",
+		Data:         json.RawMessage(`{}`),
+		SubscriberID: sub.ID,
+	}
+	err = d.store.SaveMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.store.SaveDeliveries(t.Context(), msg.ID, []uuid.UUID{endpoint.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.deliverDue(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.inFlight.Wait()
+
+	read, err := d.store.GetEndpoint(t.Context(), endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !read.Disabled {
+		t.Fatal("expected failing endpoint to be disabled")
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != EventEndpointDisabled || event.EndpointID != endpoint.ID {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+	default:
+		t.Fatal("expected endpoint disabled event")
+	}
+}
+
+func TestListen(t *testing.T) {
+	t.Parallel()
+
+	d := newTestDispatcher(t)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	wake := make(chan struct{}, 1)
+	go d.listen(ctx, wake)
+
+	// The listener signals once it is ready to catch up with earlier messages.
+	select {
+	case <-wake:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected listener to signal when ready")
+	}
+
+	sub := &database.Subscriber{Name: "test"}
+	err := d.store.SaveSubscriber(t.Context(), sub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = d.store.InTx(t.Context(), func(ctx context.Context, store *database.Store) error {
+		return store.SaveMessage(ctx, &database.Message{
+			Type:         "test.created",
+			Data:         json.RawMessage(`{}`),
+			SubscriberID: sub.ID,
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-wake:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected message insertion to wake the dispatcher")
+	}
+}
@@ -0,0 +1,80 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/google/uuid"
+)
+
+// Operational event types emitted by the dispatcher.
+const (
+	EventEndpointDisabled = "endpoint.disabled"
+)
+
+// An operational event of the delivery engine, used to alert customers and
+// operators. It is not delivered to subscriber endpoints.
+type Event struct {
+	Type         string
+	EndpointID   uuid.UUID
+	SubscriberID uuid.UUID
+	Reason       string
+	CreatedAt    time.Time
+}
+
+// Handles operational events, it must not block the caller.
+type EventHandler func(ctx context.Context, event Event)
+
+// Logs the event and hands it to the configured handler, if any.
+func (d *Dispatcher) emit(ctx context.Context, event Event) {
+	d.logger.Warn(
+		"operational event",
+		slog.String("type", event.Type),
+		slog.String("endpoint_id", event.EndpointID.String()),
+		slog.String("subscriber_id", event.SubscriberID.String()),
+		slog.String("reason", event.Reason),
+	)
+	if d.onEvent != nil {
+		d.onEvent(ctx, event)
+	}
+}
+
+// Returns a handler that POSTs events to url as webhooks signed with secret,
+// in the same format endpoints receive. The URL is set by operators, so it
+// may be a private address. Failed sends are logged and not retried.
+func NewWebhookEventHandler(url, secret string, timeout time.Duration, logger *slog.Logger) EventHandler {
+	sender := NewSender(timeout, true)
+	endpoint := &database.Endpoint{URL: url, Secret: secret}
+
+	return func(ctx context.Context, event Event) {
+		data, _ := json.Marshal(map[string]string{
+			"endpoint_id":   event.EndpointID.String(),
+			"subscriber_id": event.SubscriberID.String(),
+			"reason":        event.Reason,
+		}) // Never fails for this type
+		msg := &database.Message{
+			ID:        uuid.New(),
+			Type:      event.Type,
+			Data:      data,
+			CreatedAt: event.CreatedAt,
+		}
+
+		// Sent in the background since handlers must not block, and detached
+		// from ctx so the event isn't lost with the delivery that caused it.
+		ctx = context.WithoutCancel(ctx)
+		go func() {
+			res := sender.Send(ctx, endpoint, msg)
+			if res.Err != nil {
+				logger.Error(
+					"failed to send operational event",
+					slog.String("type", event.Type),
+					slog.String("endpoint_id", event.EndpointID.String()),
+					slog.String("err", res.Err.Error()),
+				)
+			}
+		}()
+	}
+}
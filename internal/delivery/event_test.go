@@ -0,0 +1,69 @@
+package delivery
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/webhook"
+	"github.com/ffss92/webhookd/webhook/verify"
+	"github.com/google/uuid"
+)
+
+func TestWebhookEventHandler(t *testing.T) {
+	t.Parallel()
+
+	secret := webhook.NewSecret()
+	verifier, err := verify.New(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan Payload, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if err := verifier.Verify(r.Header, body); err != nil {
+			t.Errorf("expected valid signature but got %v", err)
+		}
+		var payload Payload
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Error(err)
+		}
+		received <- payload
+	}))
+	defer srv.Close()
+
+	event := Event{
+		Type:         EventEndpointDisabled,
+		EndpointID:   uuid.New(),
+		SubscriberID: uuid.New(),
+		Reason:       "failing for more than 1h0m0s",
+		CreatedAt:    time.Now(),
+	}
+	handler := NewWebhookEventHandler(srv.URL, secret, time.Second, slog.New(slog.DiscardHandler))
+	handler(t.Context(), event)
+
+	select {
+	case payload := <-received:
+		if payload.Type != EventEndpointDisabled {
+			t.Fatalf("expected type %q but got %q", EventEndpointDisabled, payload.Type)
+		}
+		var data map[string]string
+		if err := json.Unmarshal(payload.Data, &data); err != nil {
+			t.Fatal(err)
+		}
+		if data["endpoint_id"] != event.EndpointID.String() {
+			t.Fatalf("expected endpoint id %s but got %s", event.EndpointID, data["endpoint_id"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected event to be sent")
+	}
+}
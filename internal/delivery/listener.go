@@ -0,0 +1,79 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// Delay before trying to listen again after the connection is lost.
+	listenRetryDelay = 5 * time.Second
+)
+
+// Listens for new message notifications on a dedicated connection and
+// signals wake for each of them. When the connection drops it keeps retrying
+// until ctx is cancelled, while the dispatcher falls back to polling.
+func (d *Dispatcher) listen(ctx context.Context, wake chan<- struct{}) {
+	for {
+		err := d.waitForNotifications(ctx, wake)
+		if ctx.Err() != nil {
+			return
+		}
+		d.logger.Warn(
+			"lost notification listener, falling back to polling",
+			slog.String("err", err.Error()),
+			slog.Duration("retry_in", listenRetryDelay),
+		)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+func (d *Dispatcher) waitForNotifications(ctx context.Context, wake chan<- struct{}) error {
+	conn, err := d.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	channel := pgx.Identifier{database.MessageChannel}.Sanitize()
+	_, err = conn.Exec(ctx, "LISTEN "+channel)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	defer func() {
+		// The connection goes back to the pool, so it must stop listening.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, _ = conn.Exec(ctx, "UNLISTEN "+channel)
+	}()
+
+	// Catch up with anything inserted before the listener was ready.
+	notify(wake)
+
+	for {
+		_, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		notify(wake)
+	}
+}
+
+// Signals wake without blocking, coalescing notifications while the
+// dispatcher is busy.
+func notify(wake chan<- struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,145 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/webhook"
+)
+
+const (
+	userAgent = "webhookd"
+
+	// Response bodies are truncated to this size before being recorded.
+	maxResponseBodySize = 4 << 10
+)
+
+// Payload is the JSON body POSTed to endpoints, following the structure
+// recommended by the Standard Webhooks spec.
+type Payload struct {
+	Type      string          `json:"type"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type Result struct {
+	StatusCode int
+	Header     http.Header
+	Body       string
+	Latency    time.Duration
+	Err        error
+}
+
+var ErrPrivateAddress = errors.New("destination is a private address")
+
+type Sender struct {
+	client *http.Client
+}
+
+// Endpoints are managed by end customers through portal tokens, so unless
+// allowPrivate is set, connections to loopback, link-local, private and
+// unspecified addresses are refused. The check runs on the resolved address
+// of every dial, which DNS records pointing inward can't get around.
+func NewSender(timeout time.Duration, allowPrivate bool) *Sender {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   checkPublicAddress,
+		}
+		transport.DialContext = dialer.DialContext
+		// A proxy would make the dialed address the proxy's.
+		transport.Proxy = nil
+	}
+
+	return &Sender{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   timeout,
+			// Following a redirect would turn the POST into a GET that never
+			// carries the payload, so 3xx responses fail the attempt instead.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Makes a single signed delivery attempt of msg to endpoint. Any non 2xx
+// response is reported as an error.
+func (s *Sender) Send(ctx context.Context, endpoint *database.Endpoint, msg *database.Message) Result {
+	now := time.Now()
+	signer, err := webhook.NewSigner(endpoint.Secrets(now)...)
+	if err != nil {
+		return Result{Err: fmt.Errorf("failed to create signer: %w", err)}
+	}
+
+	body, err := json.Marshal(Payload{
+		Type:      msg.Type,
+		Timestamp: msg.CreatedAt,
+		Data:      msg.Data,
+	})
+	if err != nil {
+		return Result{Err: fmt.Errorf("failed to encode payload: %w", err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return Result{Err: fmt.Errorf("failed to create request: %w", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	signer.SetHeaders(req.Header, msg.ID.String(), now, body)
+
+	start := time.Now()
+	res, err := s.client.Do(req)
+	if err != nil {
+		return Result{Latency: time.Since(start), Err: err}
+	}
+	defer res.Body.Close()
+
+	b, _ := io.ReadAll(io.LimitReader(res.Body, maxResponseBodySize))
+	result := Result{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       sanitizeBody(b),
+		Latency:    time.Since(start),
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		result.Err = fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+	return result
+}
+
+// Dialer control hook that refuses non public destinations.
+func checkPublicAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("failed to parse address: %w", err)
+	}
+	addr := addrPort.Addr().Unmap()
+	if addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsPrivate() || addr.IsUnspecified() || addr.IsMulticast() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, addr)
+	}
+	return nil
+}
+
+// Makes the response body safe to be stored as TEXT, which rejects invalid
+// UTF-8 and NUL bytes.
+func sanitizeBody(b []byte) string {
+	body := strings.ToValidUTF8(string(b), "\uFFFD")
+	return strings.ReplaceAll(body, "\x00", "")
+}
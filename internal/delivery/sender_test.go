@@ -0,0 +1,251 @@
+package delivery
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/database"
+	"github.com/ffss92/webhookd/internal/webhook"
+	"github.com/google/uuid"
+)
+
+func TestSenderSend(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{
+			name:   "ok",
+			status: http.StatusOK,
+		},
+		{
+			name:   "no content",
+			status: http.StatusNoContent,
+		},
+		{
+			name:    "server error",
+			status:  http.StatusInternalServerError,
+			wantErr: true,
+		},
+		{
+			name:    "found",
+			status:  http.StatusFound,
+			wantErr: true,
+		},
+		{
+			name:    "temporary redirect",
+			status:  http.StatusTemporaryRedirect,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			msg := &database.Message{
+				ID:        uuid.New(),
+				Type:      "test.created",
+				Data:      json.RawMessage(`{"key":"value"}`),
+				CreatedAt: time.Now(),
+			}
+
+			var redirected atomic.Bool
+			target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				redirected.Store(true)
+			}))
+			defer target.Close()
+
+			var got Payload
+			var signature string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost {
+					t.Errorf("expected method POST but got %s", r.Method)
+				}
+				signature = r.Header.Get(webhook.HeaderSignature)
+				if r.Header.Get(webhook.HeaderID) != msg.ID.String() {
+					t.Errorf("expected %s header to be the message id", webhook.HeaderID)
+				}
+				if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+					t.Error(err)
+				}
+				w.Header().Set("Location", target.URL)
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			sender := NewSender(time.Second, true)
+			endpoint := &database.Endpoint{URL: srv.URL, Secret: webhook.NewSecret()}
+			res := sender.Send(t.Context(), endpoint, msg)
+			if (res.Err != nil) != tt.wantErr {
+				t.Fatalf("expected error to be %t but got %v", tt.wantErr, res.Err)
+			}
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, res.StatusCode)
+			}
+			if got.Type != msg.Type {
+				t.Fatalf("expected payload type %q but got %q", msg.Type, got.Type)
+			}
+			if signature == "" {
+				t.Fatal("expected request to be signed")
+			}
+			if redirected.Load() {
+				t.Fatal("expected redirect to not be followed")
+			}
+		})
+	}
+}
+
+func TestSenderSend_Unreachable(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	sender := NewSender(time.Second, true)
+	endpoint := &database.Endpoint{URL: srv.URL, Secret: webhook.NewSecret()}
+	res := sender.Send(t.Context(), endpoint, &database.Message{
+		Data: json.RawMessage(`{}`),
+	})
+	if res.Err == nil {
+		t.Fatal("expected unreachable endpoint to fail")
+	}
+}
+
+func TestSenderSend_PrivateAddress(t *testing.T) {
+	t.Parallel()
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+
+	testCases := []struct {
+		name string
+		url  string
+	}{
+		{
+			name: "loopback",
+			url:  srv.URL,
+		},
+		{
+			name: "localhost",
+			url:  strings.Replace(srv.URL, "127.0.0.1", "localhost", 1),
+		},
+		{
+			name: "link-local",
+			url:  "http://169.254.169.254/latest/meta-data",
+		},
+		{
+			name: "private",
+			url:  "http://10.0.0.1",
+		},
+		{
+			name: "unspecified",
+			url:  "http://0.0.0.0",
+		},
+		{
+			name: "mapped loopback",
+			url:  "http://[::ffff:127.0.0.1]",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := NewSender(time.Second, false)
+			endpoint := &database.Endpoint{URL: tt.url, Secret: webhook.NewSecret()}
+			res := sender.Send(t.Context(), endpoint, &database.Message{
+				Data: json.RawMessage(`{}`),
+			})
+			if !errors.Is(res.Err, ErrPrivateAddress) {
+				t.Fatalf("expected error %v but got %v", ErrPrivateAddress, res.Err)
+			}
+		})
+	}
+
+	if got := hits.Load(); got != 0 {
+		t.Fatalf("expected endpoint to not be contacted but got %d requests", got)
+	}
+}
+
+func TestSenderSend_InvalidSecret(t *testing.T) {
+	t.Parallel()
+
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer srv.Close()
+
+	sender := NewSender(time.Second, true)
+	res := sender.Send(t.Context(), &database.Endpoint{URL: srv.URL}, &database.Message{
+		Data: json.RawMessage(`{}`),
+	})
+	if !errors.Is(res.Err, webhook.ErrInvalidSecret) {
+		t.Fatalf("expected ErrInvalidSecret but got %v", res.Err)
+	}
+	if hits != 0 {
+		t.Fatal("expected unsigned request to not be sent")
+	}
+}
+
+func TestSenderSend_PreviousSecret(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name       string
+		expiresAt  time.Time
+		signatures int
+	}{
+		{
+			name:       "within overlap",
+			expiresAt:  time.Now().Add(time.Hour),
+			signatures: 2,
+		},
+		{
+			name:       "expired",
+			expiresAt:  time.Now().Add(-time.Hour),
+			signatures: 1,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var signature string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				signature = r.Header.Get(webhook.HeaderSignature)
+			}))
+			defer srv.Close()
+
+			sender := NewSender(time.Second, true)
+			endpoint := &database.Endpoint{
+				URL:                     srv.URL,
+				Secret:                  webhook.NewSecret(),
+				PreviousSecret:          webhook.NewSecret(),
+				PreviousSecretExpiresAt: &tt.expiresAt,
+			}
+			res := sender.Send(t.Context(), endpoint, &database.Message{
+				ID:   uuid.New(),
+				Data: json.RawMessage(`{}`),
+			})
+			if res.Err != nil {
+				t.Fatal(res.Err)
+			}
+			if got := len(strings.Fields(signature)); got != tt.signatures {
+				t.Fatalf("expected %d signatures but got %d", tt.signatures, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+// Package filter implements wildcard endpoint filters on dot separated event
+// types. A "*" segment matches exactly one segment and a "**" segment matches
+// one or more, so "invoice.*" matches "invoice.paid" and "**.failed" matches
+// both "invoice.failed" and "invoice.payment.failed".
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	anySegment  = "*"
+	anySegments = "**"
+)
+
+var (
+	ErrInvalidPattern = errors.New("invalid pattern")
+
+	segmentRx = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+// Reports whether filter is a pattern rather than an event type.
+func IsPattern(filter string) bool {
+	return strings.Contains(filter, anySegment)
+}
+
+// Returns an anchored regular expression equivalent to pattern, in the
+// syntax shared by Go and Postgres.
+func Regexp(pattern string) (string, error) {
+	segments := strings.Split(pattern, ".")
+	parts := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		switch {
+		case segment == anySegment:
+			parts = append(parts, `[^.]+`)
+		case segment == anySegments:
+			parts = append(parts, `[^.]+(\.[^.]+)*`)
+		case segmentRx.MatchString(segment):
+			parts = append(parts, segment)
+		default:
+			return "", fmt.Errorf("%w: %q must be dot separated words of letters, digits, '_' or '-', '*' or '**'", ErrInvalidPattern, pattern)
+		}
+	}
+	return "^" + strings.Join(parts, `\.`) + "$", nil
+}
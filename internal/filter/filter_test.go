@@ -0,0 +1,105 @@
+package filter
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+)
+
+func TestRegexp(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		pattern   string
+		eventType string
+		want      bool
+		wantErr   error
+	}{
+		{
+			name:      "single segment",
+			pattern:   "invoice.*",
+			eventType: "invoice.paid",
+			want:      true,
+		},
+		{
+			name:      "single segment (too deep)",
+			pattern:   "invoice.*",
+			eventType: "invoice.payment.failed",
+			want:      false,
+		},
+		{
+			name:      "single segment (missing)",
+			pattern:   "invoice.*",
+			eventType: "invoice",
+			want:      false,
+		},
+		{
+			name:      "leading wildcard",
+			pattern:   "*.failed",
+			eventType: "invoice.failed",
+			want:      true,
+		},
+		{
+			name:      "leading wildcard (other type)",
+			pattern:   "*.failed",
+			eventType: "invoice.paid",
+			want:      false,
+		},
+		{
+			name:      "many segments",
+			pattern:   "**.failed",
+			eventType: "invoice.payment.failed",
+			want:      true,
+		},
+		{
+			name:      "many segments (one)",
+			pattern:   "invoice.**",
+			eventType: "invoice.paid",
+			want:      true,
+		},
+		{
+			name:      "literal segments",
+			pattern:   "invoice.*",
+			eventType: "invoices.paid",
+			want:      false,
+		},
+		{
+			name:      "partial segment",
+			pattern:   "inv*.paid",
+			eventType: "invoice.paid",
+			wantErr:   ErrInvalidPattern,
+		},
+		{
+			name:      "empty segment",
+			pattern:   "invoice..*",
+			eventType: "invoice.paid",
+			wantErr:   ErrInvalidPattern,
+		},
+		{
+			name:      "regexp characters",
+			pattern:   "invoice.(paid|failed)",
+			eventType: "invoice.paid",
+			wantErr:   ErrInvalidPattern,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			expr, err := Regexp(tt.pattern)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v but got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+
+			got := regexp.MustCompile(expr).MatchString(tt.eventType)
+			if got != tt.want {
+				t.Fatalf("expected match %t but got %t", tt.want, got)
+			}
+		})
+	}
+}
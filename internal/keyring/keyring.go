@@ -0,0 +1,171 @@
+// Package keyring implements envelope encryption of small values, such as
+// endpoint secrets, with versioned key encryption keys.
+//
+// Every value is sealed with its own random data key using AES-GCM, and the
+// data key is sealed with the current key encryption key. Encrypted values
+// are encoded as "enc:<version>:<sealed data key>:<sealed value>", which keeps
+// track of the key needed to open them and allows the keys to be rotated.
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	prefix = "enc:"
+	// Size of key encryption keys and data keys, selects AES-256.
+	KeySize = 32
+)
+
+var (
+	ErrInvalidKey     = errors.New("invalid key")
+	ErrUnknownVersion = errors.New("unknown key version")
+	ErrMalformed      = errors.New("malformed encrypted value")
+)
+
+// Keyring holds the key encryption keys by version. A nil keyring stores
+// values in plaintext.
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// Creates a keyring that encrypts with the current key version and decrypts
+// with any of the keys.
+func New(keys map[string][]byte, current string) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownVersion, current)
+	}
+
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for version, key := range keys {
+		if version == "" || strings.Contains(version, ":") {
+			return nil, fmt.Errorf("%w: invalid version %q", ErrInvalidKey, version)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("%w: version %q must have %d bytes", ErrInvalidKey, version, KeySize)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		aeads[version] = aead
+	}
+
+	return &Keyring{
+		current: current,
+		keys:    aeads,
+	}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Reports whether value is encrypted, as opposed to plaintext.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypts value with a new data key sealed by the current key. Returns value
+// unchanged when k is nil.
+func (k *Keyring) Encrypt(value string) (string, error) {
+	if k == nil {
+		return value, nil
+	}
+
+	dataKey := make([]byte, KeySize)
+	_, _ = rand.Read(dataKey) // Never fails according to docs
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealedKey := seal(k.keys[k.current], dataKey, []byte(k.current))
+	sealedValue := seal(aead, []byte(value), nil)
+	return prefix + k.current + ":" +
+		base64.RawStdEncoding.EncodeToString(sealedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(sealedValue), nil
+}
+
+// Decrypts a value produced by Encrypt. Plaintext values are returned as is,
+// so rows written before encryption was enabled keep working.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	version := parts[0]
+	if k == nil {
+		return "", fmt.Errorf("%w: %q", ErrUnknownVersion, version)
+	}
+	kek, ok := k.keys[version]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownVersion, version)
+	}
+
+	sealedKey, err := base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	dataKey, err := open(kek, sealedKey, []byte(version))
+	if err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	sealedValue, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	plaintext, err := open(aead, sealedValue, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// Reports whether value must be encrypted again to be sealed with the current
+// key, which is the case for plaintext values and older key versions.
+func (k *Keyring) NeedsReencrypt(value string) bool {
+	if k == nil {
+		return false
+	}
+	return !strings.HasPrefix(value, prefix+k.current+":")
+}
+
+// Prepends the random nonce to the sealed data.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, _ = rand.Read(nonce) // Never fails according to docs
+	return aead.Seal(nonce, nonce, plaintext, additionalData)
+}
+
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	return plaintext, nil
+}
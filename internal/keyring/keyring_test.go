@@ -0,0 +1,144 @@
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func testKeys(t *testing.T, versions ...string) map[string][]byte {
+	t.Helper()
+
+	keys := make(map[string][]byte, len(versions))
+	for i, version := range versions {
+		keys[version] = bytes.Repeat([]byte{byte(i + 1)}, KeySize)
+	}
+	return keys
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		keys    map[string][]byte
+		current string
+		wantErr error
+	}{
+		{
+			name:    "valid keys",
+			keys:    testKeys(t, "v1", "v2"),
+			current: "v2",
+		},
+		{
+			name:    "unknown current version",
+			keys:    testKeys(t, "v1"),
+			current: "v2",
+			wantErr: ErrUnknownVersion,
+		},
+		{
+			name:    "short key",
+			keys:    map[string][]byte{"v1": make([]byte, 16)},
+			current: "v1",
+			wantErr: ErrInvalidKey,
+		},
+		{
+			name:    "invalid version",
+			keys:    testKeys(t, "v:1"),
+			current: "v:1",
+			wantErr: ErrInvalidKey,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := New(tt.keys, tt.current)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	t.Parallel()
+
+	keys := testKeys(t, "v1", "v2")
+	old, err := New(keys, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := New(keys, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const secret = "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"
+	encrypted, err := old.Encrypt(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(encrypted) || encrypted == secret {
+		t.Fatalf("expected value to be encrypted but got %q", encrypted)
+	}
+
+	// Values sealed with an older key can still be opened after rotation.
+	decrypted, err := current.Decrypt(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != secret {
+		t.Fatalf("expected %q but got %q", secret, decrypted)
+	}
+
+	if !current.NeedsReencrypt(encrypted) {
+		t.Fatal("expected value sealed with an older key to need re-encryption")
+	}
+	if !current.NeedsReencrypt(secret) {
+		t.Fatal("expected plaintext value to need re-encryption")
+	}
+	if old.NeedsReencrypt(encrypted) {
+		t.Fatal("expected value sealed with the current key to not need re-encryption")
+	}
+
+	tampered := encrypted[:len(encrypted)-2] + "AA"
+	if _, err := current.Decrypt(tampered); !errors.Is(err, ErrMalformed) {
+		t.Fatalf("expected ErrMalformed but got %v", err)
+	}
+
+	other, err := New(testKeys(t, "v3"), "v3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Decrypt(encrypted); !errors.Is(err, ErrUnknownVersion) {
+		t.Fatalf("expected ErrUnknownVersion but got %v", err)
+	}
+}
+
+func TestKeyring_Nil(t *testing.T) {
+	t.Parallel()
+
+	var k *Keyring
+
+	const secret = "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"
+	encrypted, err := k.Encrypt(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypted != secret {
+		t.Fatalf("expected nil keyring to store plaintext but got %q", encrypted)
+	}
+
+	decrypted, err := k.Decrypt(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decrypted != secret {
+		t.Fatalf("expected %q but got %q", secret, decrypted)
+	}
+	if k.NeedsReencrypt(secret) {
+		t.Fatal("expected nil keyring to never re-encrypt")
+	}
+}
@@ -0,0 +1,92 @@
+package retry
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// Limits of custom schedules.
+const (
+	MaxAttempts = 20
+	MaxDelay    = 7 * 24 * time.Hour
+)
+
+// DefaultSchedule follows the Standard Webhooks recommendation. The first
+// entry is always 0 since first attempts are due as soon as the message is
+// accepted.
+var DefaultSchedule = []time.Duration{
+	0,
+	5 * time.Second,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	5 * time.Hour,
+	10 * time.Hour,
+	10 * time.Hour,
+}
+
+// Checks schedule starts with 0 and has at most MaxAttempts delays of up to
+// MaxDelay. Errors read as the end of a sentence, such as "must start with 0".
+func CheckSchedule(schedule []time.Duration) error {
+	if len(schedule) > MaxAttempts {
+		return fmt.Errorf("must have at most %d entries", MaxAttempts)
+	}
+	if len(schedule) > 0 && schedule[0] != 0 {
+		return fmt.Errorf("must start with 0")
+	}
+	for _, delay := range schedule {
+		if delay < 0 || delay > MaxDelay {
+			return fmt.Errorf("must have delays between 0 and %s", MaxDelay)
+		}
+	}
+	return nil
+}
+
+// DefaultJitter randomizes each delay by up to 20% in either direction.
+const DefaultJitter = 0.2
+
+// Policy defines when failed deliveries are retried.
+type Policy struct {
+	// Delay before each attempt, the number of entries is the maximum
+	// number of attempts. The first entry must be 0, first attempts aren't
+	// delayed.
+	Schedule []time.Duration
+	// Fraction of each delay that is randomly added or subtracted, between 0 and 1.
+	Jitter float64
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		Schedule: DefaultSchedule,
+		Jitter:   DefaultJitter,
+	}
+}
+
+// Returns a copy of p using schedule, unless schedule is empty.
+func (p Policy) WithSchedule(schedule []time.Duration) Policy {
+	if len(schedule) > 0 {
+		p.Schedule = schedule
+	}
+	return p
+}
+
+func (p Policy) MaxAttempts() int {
+	return len(p.Schedule)
+}
+
+// Returns the delay before the next attempt given the number of attempts
+// already made, or false if no attempts are left.
+func (p Policy) NextDelay(attempts int) (time.Duration, bool) {
+	if attempts < 0 || attempts >= len(p.Schedule) {
+		return 0, false
+	}
+
+	delay := p.Schedule[attempts]
+	if p.Jitter > 0 && delay > 0 {
+		// Uniformly distributed in [-jitter, +jitter).
+		factor := 1 + p.Jitter*(2*rand.Float64()-1)
+		delay = time.Duration(float64(delay) * factor)
+	}
+	return delay, true
+}
@@ -0,0 +1,142 @@
+package retry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyNextDelay(t *testing.T) {
+	policy := Policy{
+		Schedule: []time.Duration{0, time.Second, time.Minute},
+	}
+
+	testCases := []struct {
+		name     string
+		attempts int
+		expected time.Duration
+		ok       bool
+	}{
+		{
+			name:     "first attempt",
+			attempts: 0,
+			expected: 0,
+			ok:       true,
+		},
+		{
+			name:     "second attempt",
+			attempts: 1,
+			expected: time.Second,
+			ok:       true,
+		},
+		{
+			name:     "last attempt",
+			attempts: 2,
+			expected: time.Minute,
+			ok:       true,
+		},
+		{
+			name:     "exhausted",
+			attempts: 3,
+			ok:       false,
+		},
+		{
+			name:     "negative",
+			attempts: -1,
+			ok:       false,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, ok := policy.NextDelay(tt.attempts)
+			if ok != tt.ok {
+				t.Fatalf("expected ok to be %t but got %t", tt.ok, ok)
+			}
+			if delay != tt.expected {
+				t.Fatalf("expected delay %s but got %s", tt.expected, delay)
+			}
+		})
+	}
+}
+
+func TestPolicyNextDelay_Jitter(t *testing.T) {
+	policy := Policy{
+		Schedule: []time.Duration{0, time.Minute},
+		Jitter:   0.5,
+	}
+
+	for range 100 {
+		delay, ok := policy.NextDelay(1)
+		if !ok {
+			t.Fatal("expected attempt to be available")
+		}
+		if delay < 30*time.Second || delay > 90*time.Second {
+			t.Fatalf("expected delay to be within jitter bounds but got %s", delay)
+		}
+	}
+
+	delay, _ := policy.NextDelay(0)
+	if delay != 0 {
+		t.Fatalf("expected immediate attempt to not be jittered but got %s", delay)
+	}
+}
+
+func TestPolicyWithSchedule(t *testing.T) {
+	policy := DefaultPolicy()
+
+	override := []time.Duration{time.Second}
+	if got := policy.WithSchedule(override).MaxAttempts(); got != 1 {
+		t.Fatalf("expected override to have 1 attempt but got %d", got)
+	}
+	if got := policy.WithSchedule(nil).MaxAttempts(); got != len(DefaultSchedule) {
+		t.Fatalf("expected empty override to keep the default schedule but got %d attempts", got)
+	}
+	if policy.MaxAttempts() != len(DefaultSchedule) {
+		t.Fatal("expected WithSchedule to not modify the original policy")
+	}
+}
+
+func TestCheckSchedule(t *testing.T) {
+	testCases := []struct {
+		name     string
+		schedule []time.Duration
+		wantErr  bool
+	}{
+		{
+			name:     "default",
+			schedule: DefaultSchedule,
+		},
+		{
+			name: "empty",
+		},
+		{
+			name:     "delayed first attempt",
+			schedule: []time.Duration{time.Minute},
+			wantErr:  true,
+		},
+		{
+			name:     "negative delay",
+			schedule: []time.Duration{0, -time.Second},
+			wantErr:  true,
+		},
+		{
+			name:     "delay too long",
+			schedule: []time.Duration{0, MaxDelay + time.Second},
+			wantErr:  true,
+		},
+		{
+			name:     "too many entries",
+			schedule: make([]time.Duration, MaxAttempts+1),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckSchedule(tt.schedule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error to be %t but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
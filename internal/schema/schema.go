@@ -0,0 +1,94 @@
+// Package schema validates message payloads against the JSON Schema of their
+// event type.
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+var (
+	ErrInvalidSchema = errors.New("invalid schema")
+)
+
+type Schema struct {
+	schema *gojsonschema.Schema
+}
+
+// Compiles a JSON Schema document. Only references local to the document are
+// allowed, resolving remote ones would make requests to arbitrary URLs.
+func Compile(raw json.RawMessage) (*Schema, error) {
+	var document any
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSchema, err)
+	}
+	if _, ok := document.(map[string]any); !ok {
+		return nil, fmt.Errorf("%w: must be a JSON object", ErrInvalidSchema)
+	}
+	if err := checkRefs(document); err != nil {
+		return nil, err
+	}
+
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(document))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSchema, err)
+	}
+	return &Schema{schema: schema}, nil
+}
+
+func checkRefs(node any) error {
+	switch node := node.(type) {
+	case map[string]any:
+		for key, value := range node {
+			if ref, ok := value.(string); ok && key == "$ref" && !strings.HasPrefix(ref, "#") {
+				return fmt.Errorf("%w: only local references are allowed, got %q", ErrInvalidSchema, ref)
+			}
+			if err := checkRefs(value); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, value := range node {
+			if err := checkRefs(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Violation of the schema. Field is the dot separated path of the offending
+// value, empty for the document root.
+type FieldError struct {
+	Field       string
+	Description string
+}
+
+// Validates data against the schema, returning the violations found.
+func (s *Schema) Validate(data json.RawMessage) ([]FieldError, error) {
+	result, err := s.schema.Validate(gojsonschema.NewBytesLoader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate data: %w", err)
+	}
+
+	errs := make([]FieldError, 0, len(result.Errors()))
+	for _, resultErr := range result.Errors() {
+		path := resultErr.Field()
+		if path == gojsonschema.STRING_CONTEXT_ROOT {
+			path = ""
+		}
+		// Missing properties are reported on their parent.
+		if property, ok := resultErr.Details()["property"].(string); ok && resultErr.Type() == "required" {
+			path = strings.TrimPrefix(path+"."+property, ".")
+		}
+		errs = append(errs, FieldError{
+			Field:       path,
+			Description: resultErr.Description(),
+		})
+	}
+	return errs, nil
+}
@@ -0,0 +1,129 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompile(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		schema  string
+		wantErr error
+	}{
+		{
+			name:   "valid schema",
+			schema: `{"type": "object", "properties": {"id": {"type": "string"}}}`,
+		},
+		{
+			name:   "local reference",
+			schema: `{"definitions": {"id": {"type": "string"}}, "properties": {"id": {"$ref": "#/definitions/id"}}}`,
+		},
+		{
+			name:    "remote reference",
+			schema:  `{"properties": {"id": {"$ref": "https://example.com/id.json"}}}`,
+			wantErr: ErrInvalidSchema,
+		},
+		{
+			name:    "not an object",
+			schema:  `[]`,
+			wantErr: ErrInvalidSchema,
+		},
+		{
+			name:    "invalid keyword value",
+			schema:  `{"type": "unknown"}`,
+			wantErr: ErrInvalidSchema,
+		},
+		{
+			name:    "invalid json",
+			schema:  `{`,
+			wantErr: ErrInvalidSchema,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Compile(json.RawMessage(tt.schema))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	t.Parallel()
+
+	schema, err := Compile(json.RawMessage(`{
+		"type": "object",
+		"required": ["id", "customer"],
+		"properties": {
+			"id": {"type": "string"},
+			"customer": {
+				"type": "object",
+				"required": ["email"],
+				"properties": {"email": {"type": "string"}}
+			}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name   string
+		data   string
+		fields []string
+	}{
+		{
+			name:   "valid data",
+			data:   `{"id": "inv_1", "customer": {"email": "jane@example.com"}}`,
+			fields: []string{},
+		},
+		{
+			name:   "missing property",
+			data:   `{"id": "inv_1"}`,
+			fields: []string{"customer"},
+		},
+		{
+			name:   "missing nested property",
+			data:   `{"id": "inv_1", "customer": {}}`,
+			fields: []string{"customer.email"},
+		},
+		{
+			name:   "wrong type",
+			data:   `{"id": 1, "customer": {"email": "jane@example.com"}}`,
+			fields: []string{"id"},
+		},
+		{
+			name:   "wrong root type",
+			data:   `[]`,
+			fields: []string{""},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			errs, err := schema.Validate(json.RawMessage(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fields := make([]string, 0, len(errs))
+			for _, fieldErr := range errs {
+				fields = append(fields, fieldErr.Field)
+			}
+			if diff := cmp.Diff(tt.fields, fields); diff != "" {
+				t.Fatalf("mismatch (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+// Package transform converts message data between event type versions with
+// declarative operations on dot separated paths.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Moves the value at From to Path.
+	OpRename = "rename"
+	// Copies the value at From to Path.
+	OpCopy = "copy"
+	// Sets Path to Value.
+	OpSet = "set"
+	// Removes the value at Path.
+	OpRemove = "remove"
+)
+
+// Transforms are limited so applying them stays cheap.
+const maxOperations = 100
+
+var (
+	ErrInvalidTransform = errors.New("invalid transform")
+)
+
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Operations applied in order. Renames and copies of missing values are
+// skipped, so transforms also work on data where optional fields are absent.
+type Transform []Operation
+
+// Parses and validates a transform, a missing or null transform does
+// nothing.
+func Parse(raw json.RawMessage) (Transform, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var t Transform
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&t); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTransform, err)
+	}
+	if len(t) > maxOperations {
+		return nil, fmt.Errorf("%w: must have at most %d operations", ErrInvalidTransform, maxOperations)
+	}
+
+	for i, op := range t {
+		if err := op.validate(); err != nil {
+			return nil, fmt.Errorf("%w: operation %d: %w", ErrInvalidTransform, i, err)
+		}
+	}
+	return t, nil
+}
+
+func (op Operation) validate() error {
+	if !validPath(op.Path) {
+		return fmt.Errorf("invalid path %q", op.Path)
+	}
+
+	switch op.Op {
+	case OpRename, OpCopy:
+		if !validPath(op.From) {
+			return fmt.Errorf("invalid from %q", op.From)
+		}
+		if op.From == op.Path || strings.HasPrefix(op.Path, op.From+".") {
+			return fmt.Errorf("can't %s %q into itself", op.Op, op.From)
+		}
+	case OpSet:
+		if len(op.Value) == 0 {
+			return errors.New("missing value")
+		}
+	case OpRemove:
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+	return nil
+}
+
+func validPath(path string) bool {
+	if path == "" {
+		return false
+	}
+	for segment := range strings.SplitSeq(path, ".") {
+		if segment == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Applies the transform to data, which must be a JSON object.
+func (t Transform) Apply(data json.RawMessage) (json.RawMessage, error) {
+	if len(t) == 0 {
+		return data, nil
+	}
+
+	var document map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// Keeps numbers as they were sent.
+	dec.UseNumber()
+	if err := dec.Decode(&document); err != nil {
+		return nil, fmt.Errorf("failed to decode data: %w", err)
+	}
+	if document == nil {
+		return nil, errors.New("data must be a JSON object")
+	}
+
+	for _, op := range t {
+		if err := op.apply(document); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode data: %w", err)
+	}
+	return b, nil
+}
+
+func (op Operation) apply(document map[string]any) error {
+	switch op.Op {
+	case OpRename:
+		value, ok := remove(document, op.From)
+		if !ok {
+			return nil
+		}
+		return set(document, op.Path, value)
+	case OpCopy:
+		value, ok := get(document, op.From)
+		if !ok {
+			return nil
+		}
+		return set(document, op.Path, clone(value))
+	case OpSet:
+		dec := json.NewDecoder(bytes.NewReader(op.Value))
+		dec.UseNumber()
+		var value any
+		if err := dec.Decode(&value); err != nil {
+			return fmt.Errorf("failed to decode value of %q: %w", op.Path, err)
+		}
+		return set(document, op.Path, value)
+	case OpRemove:
+		remove(document, op.Path)
+		return nil
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+}
+
+// Returns the object holding the last segment of path, and that segment.
+func parent(document map[string]any, path string, create bool) (map[string]any, string, error) {
+	segments := strings.Split(path, ".")
+	current := document
+	for i, segment := range segments[:len(segments)-1] {
+		next, ok := current[segment]
+		if !ok && create {
+			child := make(map[string]any)
+			current[segment] = child
+			current = child
+			continue
+		}
+		child, ok := next.(map[string]any)
+		if !ok {
+			return nil, "", fmt.Errorf("%q is not an object", strings.Join(segments[:i+1], "."))
+		}
+		current = child
+	}
+	return current, segments[len(segments)-1], nil
+}
+
+func get(document map[string]any, path string) (any, bool) {
+	obj, key, err := parent(document, path, false)
+	if err != nil {
+		return nil, false
+	}
+	value, ok := obj[key]
+	return value, ok
+}
+
+func set(document map[string]any, path string, value any) error {
+	obj, key, err := parent(document, path, true)
+	if err != nil {
+		return fmt.Errorf("failed to set %q: %w", path, err)
+	}
+	obj[key] = value
+	return nil
+}
+
+func remove(document map[string]any, path string) (any, bool) {
+	obj, key, err := parent(document, path, false)
+	if err != nil {
+		return nil, false
+	}
+	value, ok := obj[key]
+	delete(obj, key)
+	return value, ok
+}
+
+// Deep copies decoded JSON, so copies can be changed independently.
+func clone(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(value))
+		for k, v := range value {
+			c[k] = clone(v)
+		}
+		return c
+	case []any:
+		c := make([]any, len(value))
+		for i, v := range value {
+			c[i] = clone(v)
+		}
+		return c
+	default:
+		return value
+	}
+}
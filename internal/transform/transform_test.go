@@ -0,0 +1,145 @@
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		transform string
+		wantErr   error
+	}{
+		{
+			name:      "valid transform",
+			transform: `[{"op": "rename", "from": "customer.email", "path": "email"}, {"op": "set", "path": "currency", "value": "usd"}]`,
+		},
+		{
+			name:      "null",
+			transform: `null`,
+		},
+		{
+			name:      "unknown op",
+			transform: `[{"op": "move", "from": "a", "path": "b"}]`,
+			wantErr:   ErrInvalidTransform,
+		},
+		{
+			name:      "empty path segment",
+			transform: `[{"op": "remove", "path": "customer..email"}]`,
+			wantErr:   ErrInvalidTransform,
+		},
+		{
+			name:      "missing from",
+			transform: `[{"op": "copy", "path": "email"}]`,
+			wantErr:   ErrInvalidTransform,
+		},
+		{
+			name:      "rename into itself",
+			transform: `[{"op": "rename", "from": "customer", "path": "customer.old"}]`,
+			wantErr:   ErrInvalidTransform,
+		},
+		{
+			name:      "missing value",
+			transform: `[{"op": "set", "path": "currency"}]`,
+			wantErr:   ErrInvalidTransform,
+		},
+		{
+			name:      "unknown field",
+			transform: `[{"op": "remove", "path": "id", "to": "other"}]`,
+			wantErr:   ErrInvalidTransform,
+		},
+		{
+			name:      "not an array",
+			transform: `{"op": "remove", "path": "id"}`,
+			wantErr:   ErrInvalidTransform,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := Parse(json.RawMessage(tt.transform))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v but got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTransformApply(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		transform string
+		data      string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "rename",
+			transform: `[{"op": "rename", "from": "customer.email", "path": "email"}]`,
+			data:      `{"customer": {"email": "jane@example.com", "name": "Jane"}}`,
+			want:      `{"customer":{"name":"Jane"},"email":"jane@example.com"}`,
+		},
+		{
+			name:      "rename missing value",
+			transform: `[{"op": "rename", "from": "customer.email", "path": "email"}]`,
+			data:      `{"id": 1}`,
+			want:      `{"id":1}`,
+		},
+		{
+			name:      "copy",
+			transform: `[{"op": "copy", "from": "customer", "path": "buyer"}, {"op": "remove", "path": "buyer.name"}]`,
+			data:      `{"customer": {"name": "Jane"}}`,
+			want:      `{"buyer":{},"customer":{"name":"Jane"}}`,
+		},
+		{
+			name:      "set nested",
+			transform: `[{"op": "set", "path": "amount.currency", "value": "usd"}]`,
+			data:      `{"id": 1}`,
+			want:      `{"amount":{"currency":"usd"},"id":1}`,
+		},
+		{
+			name:      "keeps numbers",
+			transform: `[{"op": "remove", "path": "id"}]`,
+			data:      `{"id": 1, "amount": 12345678901234567890}`,
+			want:      `{"amount":12345678901234567890}`,
+		},
+		{
+			name:      "set through non object",
+			transform: `[{"op": "set", "path": "id.value", "value": 1}]`,
+			data:      `{"id": 1}`,
+			wantErr:   true,
+		},
+		{
+			name:      "non object data",
+			transform: `[{"op": "remove", "path": "id"}]`,
+			data:      `[]`,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			transform, err := Parse(json.RawMessage(tt.transform))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := transform.Apply(json.RawMessage(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %t but got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Fatalf("expected %s but got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package validator
 import (
 	"net/mail"
 	"net/url"
+	"regexp"
+	"slices"
 	"strings"
 	"unicode/utf8"
 )
@@ -35,3 +37,11 @@ func HTTPUrl(value string) bool {
 	}
 	return false
 }
+
+func Matches(value string, rx *regexp.Regexp) bool {
+	return rx.MatchString(value)
+}
+
+func PermittedValue[T comparable](value T, permitted ...T) bool {
+	return slices.Contains(permitted, value)
+}
@@ -1,6 +1,9 @@
 package validator
 
-import "testing"
+import (
+	"regexp"
+	"testing"
+)
 
 func TestNotBlank(t *testing.T) {
 	testCases := []struct {
@@ -234,3 +237,71 @@ func TestHTTPUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestMatches(t *testing.T) {
+	rx := regexp.MustCompile(`^[a-z]+$`)
+
+	testCases := []struct {
+		name     string
+		value    string
+		expected bool
+	}{
+		{
+			name:     "match",
+			value:    "foo",
+			expected: true,
+		},
+		{
+			name:     "no match",
+			value:    "foo1",
+			expected: false,
+		},
+		{
+			name:     "empty",
+			value:    "",
+			expected: false,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Matches(tt.value, rx)
+			if result != tt.expected {
+				t.Fatalf("expected Matches(%q) to return %t but got %t", tt.value, tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestPermittedValue(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    string
+		expected bool
+	}{
+		{
+			name:     "permitted",
+			value:    "merge",
+			expected: true,
+		},
+		{
+			name:     "not permitted",
+			value:    "append",
+			expected: false,
+		},
+		{
+			name:     "empty",
+			value:    "",
+			expected: false,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			result := PermittedValue(tt.value, "merge", "replace")
+			if result != tt.expected {
+				t.Fatalf("expected PermittedValue(%q) to return %t but got %t", tt.value, tt.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ffss92/webhookd/webhook/signature"
+)
+
+const (
+	HeaderID        = signature.HeaderID
+	HeaderTimestamp = signature.HeaderTimestamp
+	HeaderSignature = signature.HeaderSignature
+)
+
+var (
+	ErrInvalidSecret = signature.ErrInvalidSecret
+)
+
+// Decodes a whsec_ prefixed secret into its raw key.
+func ParseSecret(secret string) ([]byte, error) {
+	return signature.ParseSecret(secret)
+}
+
+// Signer signs webhook requests according to the Standard Webhooks spec.
+type Signer struct {
+	keys [][]byte
+}
+
+// Creates a signer for the given secrets. Every secret produces its own
+// signature, which allows consumers to verify with any of them.
+func NewSigner(secrets ...string) (*Signer, error) {
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("%w: at least one secret is required", ErrInvalidSecret)
+	}
+
+	keys := make([][]byte, 0, len(secrets))
+	for _, secret := range secrets {
+		key, err := ParseSecret(secret)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return &Signer{keys: keys}, nil
+}
+
+// Returns the space separated list of signatures for the "id.timestamp.body"
+// content, suitable for the webhook-signature header.
+func (s *Signer) Sign(id string, timestamp time.Time, body []byte) string {
+	signatures := make([]string, 0, len(s.keys))
+	for _, key := range s.keys {
+		signatures = append(signatures, signature.Compute(key, id, timestamp, body))
+	}
+	return strings.Join(signatures, " ")
+}
+
+// Sets the webhook-id, webhook-timestamp and webhook-signature headers.
+func (s *Signer) SetHeaders(header http.Header, id string, timestamp time.Time, body []byte) {
+	header.Set(HeaderID, id)
+	header.Set(HeaderTimestamp, signature.FormatTimestamp(timestamp))
+	header.Set(HeaderSignature, s.Sign(id, timestamp, body))
+}
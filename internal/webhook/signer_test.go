@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignerSign(t *testing.T) {
+	// Reference values from the Standard Webhooks test suite.
+	secret := "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"
+	id := "msg_p5jXN8AQM9LWM0D4loKWxJek"
+	timestamp := time.Unix(1614265330, 0)
+	body := []byte(`{"test": 2432232314}`)
+	expected := "v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE="
+
+	signer, err := NewSigner(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := signer.Sign(id, timestamp, body)
+	if got != expected {
+		t.Fatalf("expected signature %q but got %q", expected, got)
+	}
+}
+
+func TestSignerSign_MultipleSecrets(t *testing.T) {
+	signer, err := NewSigner(NewSecret(), NewSecret())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := signer.Sign("msg_1", time.Now(), []byte(`{}`))
+	signatures := strings.Split(got, " ")
+	if len(signatures) != 2 {
+		t.Fatalf("expected 2 signatures but got %q", got)
+	}
+	for _, signature := range signatures {
+		if !strings.HasPrefix(signature, "v1,") {
+			t.Fatalf("expected signature to have \"v1,\" prefix but got %q", signature)
+		}
+	}
+}
+
+func TestSignerSetHeaders(t *testing.T) {
+	signer, err := NewSigner(NewSecret())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := make(http.Header)
+	signer.SetHeaders(header, "msg_1", time.Unix(1614265330, 0), []byte(`{}`))
+
+	if got := header.Get(HeaderID); got != "msg_1" {
+		t.Fatalf("expected %s header to be %q but got %q", HeaderID, "msg_1", got)
+	}
+	if got := header.Get(HeaderTimestamp); got != "1614265330" {
+		t.Fatalf("expected %s header to be %q but got %q", HeaderTimestamp, "1614265330", got)
+	}
+	if got := header.Get(HeaderSignature); got == "" {
+		t.Fatalf("expected %s header to be set", HeaderSignature)
+	}
+}
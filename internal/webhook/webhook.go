@@ -3,6 +3,8 @@ package webhook
 import (
 	"crypto/rand"
 	"encoding/base64"
+
+	"github.com/ffss92/webhookd/webhook/signature"
 )
 
 const (
@@ -14,5 +16,5 @@ func NewSecret() string {
 	b := make([]byte, secretSize)
 	_, _ = rand.Read(b) // Never fails according to docs
 	secret := base64.StdEncoding.EncodeToString(b)
-	return "whsec_" + secret
+	return signature.SecretPrefix + secret
 }
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "messages" ADD COLUMN "dispatched_at" TIMESTAMPTZ;
+CREATE INDEX "messages_pending_idx" ON "messages"("created_at") WHERE "dispatched_at" IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX "messages_pending_idx";
+ALTER TABLE "messages" DROP COLUMN "dispatched_at";
+-- +goose StatementEnd
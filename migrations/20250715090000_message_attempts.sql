@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "message_attempts" (
+    "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    "message_id" UUID NOT NULL,
+    "endpoint_id" UUID NOT NULL,
+    "attempt" INTEGER NOT NULL,
+    "status_code" INTEGER NOT NULL,
+    "response_headers" JSONB NOT NULL,
+    "response_body" TEXT NOT NULL,
+    "latency_ms" INTEGER NOT NULL,
+    "error" TEXT NOT NULL,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY ("message_id") REFERENCES "messages"("id") ON DELETE CASCADE,
+    FOREIGN KEY ("endpoint_id") REFERENCES "endpoints"("id") ON DELETE CASCADE
+);
+CREATE INDEX "message_attempts_message_idx" ON "message_attempts"("message_id", "created_at");
+CREATE INDEX "message_attempts_endpoint_idx" ON "message_attempts"("endpoint_id", "created_at");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "message_attempts";
+-- +goose StatementEnd
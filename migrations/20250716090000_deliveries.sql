@@ -0,0 +1,27 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "endpoints" ADD COLUMN "retry_schedule" INTEGER[];
+
+CREATE TABLE "deliveries" (
+    "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    "message_id" UUID NOT NULL,
+    "endpoint_id" UUID NOT NULL,
+    "status" TEXT NOT NULL DEFAULT 'pending',
+    "attempts" INTEGER NOT NULL DEFAULT 0,
+    "next_attempt_at" TIMESTAMPTZ,
+    "last_attempt_at" TIMESTAMPTZ,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE ("message_id", "endpoint_id"),
+    FOREIGN KEY ("message_id") REFERENCES "messages"("id") ON DELETE CASCADE,
+    FOREIGN KEY ("endpoint_id") REFERENCES "endpoints"("id") ON DELETE CASCADE
+);
+CREATE INDEX "deliveries_endpoint_idx" ON "deliveries"("endpoint_id");
+CREATE INDEX "deliveries_due_idx" ON "deliveries"("next_attempt_at") WHERE "status" = 'pending';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "deliveries";
+ALTER TABLE "endpoints" DROP COLUMN "retry_schedule";
+-- +goose StatementEnd
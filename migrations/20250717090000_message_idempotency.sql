@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "messages" ADD COLUMN "idempotency_key" TEXT;
+ALTER TABLE "messages" ADD COLUMN "request_hash" TEXT;
+CREATE UNIQUE INDEX "messages_idempotency_key_idx" ON "messages"("subscriber_id", "idempotency_key")
+WHERE "idempotency_key" IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX "messages_idempotency_key_idx";
+ALTER TABLE "messages" DROP COLUMN "request_hash";
+ALTER TABLE "messages" DROP COLUMN "idempotency_key";
+-- +goose StatementEnd
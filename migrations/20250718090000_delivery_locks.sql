@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "deliveries" ADD COLUMN "locked_until" TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "deliveries" DROP COLUMN "locked_until";
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "endpoints" ADD COLUMN "max_in_flight" INTEGER;
+CREATE INDEX "deliveries_locked_idx" ON "deliveries"("endpoint_id", "locked_until")
+WHERE "locked_until" IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX "deliveries_locked_idx";
+ALTER TABLE "endpoints" DROP COLUMN "max_in_flight";
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "endpoints" ADD COLUMN "consecutive_failures" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "endpoints" ADD COLUMN "failing_since" TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "endpoints" DROP COLUMN "failing_since";
+ALTER TABLE "endpoints" DROP COLUMN "consecutive_failures";
+-- +goose StatementEnd
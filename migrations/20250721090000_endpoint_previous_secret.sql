@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "endpoints" ADD COLUMN "previous_secret" TEXT;
+ALTER TABLE "endpoints" ADD COLUMN "previous_secret_expires_at" TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "endpoints" DROP COLUMN "previous_secret_expires_at";
+ALTER TABLE "endpoints" DROP COLUMN "previous_secret";
+-- +goose StatementEnd
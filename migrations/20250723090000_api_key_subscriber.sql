@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "api_keys" ADD COLUMN "subscriber_id" UUID
+REFERENCES "subscribers"("id") ON DELETE CASCADE;
+CREATE INDEX "api_keys_subscriber_idx" ON "api_keys"("subscriber_id");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "api_keys" DROP COLUMN "subscriber_id";
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE INDEX "subscribers_created_idx" ON "subscribers"("created_at", "id");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX "subscribers_created_idx";
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "applications" (
+    "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    "name" TEXT NOT NULL,
+    "retry_schedule" INTEGER[],
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Owns the data created before applications were introduced.
+INSERT INTO "applications" ("id", "name")
+VALUES ('00000000-0000-4000-8000-000000000001', 'Default');
+
+ALTER TABLE "subscribers"
+    ADD COLUMN "application_id" UUID NOT NULL DEFAULT '00000000-0000-4000-8000-000000000001'
+    REFERENCES "applications"("id") ON DELETE CASCADE;
+ALTER TABLE "subscribers" ALTER COLUMN "application_id" DROP DEFAULT;
+CREATE INDEX "subscribers_application_idx" ON "subscribers"("application_id", "created_at", "id");
+
+ALTER TABLE "api_keys"
+    ADD COLUMN "application_id" UUID NOT NULL DEFAULT '00000000-0000-4000-8000-000000000001'
+    REFERENCES "applications"("id") ON DELETE CASCADE;
+ALTER TABLE "api_keys" ALTER COLUMN "application_id" DROP DEFAULT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "api_keys" DROP COLUMN "application_id";
+DROP INDEX "subscribers_application_idx";
+ALTER TABLE "subscribers" DROP COLUMN "application_id";
+DROP TABLE "applications";
+-- +goose StatementEnd
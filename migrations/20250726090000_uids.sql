@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE "subscribers" ADD COLUMN "uid" TEXT;
+CREATE UNIQUE INDEX "subscribers_uid_idx" ON "subscribers"("application_id", "uid");
+
+-- Endpoint uids are unique per application, which endpoints now record.
+ALTER TABLE "endpoints" ADD COLUMN "application_id" UUID
+REFERENCES "applications"("id") ON DELETE CASCADE;
+UPDATE "endpoints" e SET "application_id" = s."application_id"
+FROM "subscribers" s
+WHERE s."id" = e."subscriber_id";
+ALTER TABLE "endpoints" ALTER COLUMN "application_id" SET NOT NULL;
+
+ALTER TABLE "endpoints" ADD COLUMN "uid" TEXT;
+CREATE UNIQUE INDEX "endpoints_uid_idx" ON "endpoints"("application_id", "uid");
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "endpoints" DROP COLUMN "uid";
+ALTER TABLE "endpoints" DROP COLUMN "application_id";
+ALTER TABLE "subscribers" DROP COLUMN "uid";
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "event_types" (
+    "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    "application_id" UUID NOT NULL,
+    "name" TEXT NOT NULL,
+    "description" TEXT NOT NULL DEFAULT '',
+    "schema" JSONB,
+    "deprecated" BOOLEAN NOT NULL DEFAULT FALSE,
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY ("application_id") REFERENCES "applications"("id") ON DELETE CASCADE,
+    UNIQUE ("application_id", "name")
+);
+
+-- Registers the types already in use, so existing producers keep working.
+INSERT INTO "event_types" ("application_id", "name")
+SELECT "application_id", unnest("filter_types") FROM "endpoints"
+UNION
+SELECT s."application_id", m."type"
+FROM "messages" m
+JOIN "subscribers" s ON s."id" = m."subscriber_id"
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE "event_types";
+-- +goose StatementEnd
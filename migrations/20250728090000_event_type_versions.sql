@@ -0,0 +1,38 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE "event_type_versions" (
+    "id" UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    "event_type_id" UUID NOT NULL,
+    "version" INTEGER NOT NULL,
+    "schema" JSONB,
+    -- Operations converting data of this version to the previous one.
+    "transform" JSONB NOT NULL DEFAULT '[]',
+    "created_at" TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY ("event_type_id") REFERENCES "event_types"("id") ON DELETE CASCADE,
+    UNIQUE ("event_type_id", "version")
+);
+
+-- Existing schemas become the first version of their type.
+INSERT INTO "event_type_versions" ("event_type_id", "version", "schema")
+SELECT "id", 1, "schema" FROM "event_types";
+
+ALTER TABLE "event_types" DROP COLUMN "schema";
+ALTER TABLE "event_types" ADD COLUMN "version" INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE "messages" ADD COLUMN "version" INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE "endpoints" ADD COLUMN "version_pins" JSONB NOT NULL DEFAULT '{}';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "endpoints" DROP COLUMN "version_pins";
+ALTER TABLE "messages" DROP COLUMN "version";
+
+ALTER TABLE "event_types" ADD COLUMN "schema" JSONB;
+UPDATE "event_types" e SET "schema" = v."schema"
+FROM "event_type_versions" v
+WHERE v."event_type_id" = e."id" AND v."version" = e."version";
+ALTER TABLE "event_types" DROP COLUMN "version";
+
+DROP TABLE "event_type_versions";
+-- +goose StatementEnd
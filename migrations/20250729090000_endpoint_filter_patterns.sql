@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Regular expressions of the wildcard entries of filter_types.
+ALTER TABLE "endpoints" ADD COLUMN "filter_patterns" TEXT[] NOT NULL DEFAULT '{}';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE "endpoints" DROP COLUMN "filter_patterns";
+-- +goose StatementEnd
@@ -0,0 +1,77 @@
+// Package signature implements the Standard Webhooks signature scheme shared by
+// the webhookd sender and webhook receivers.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderID        = "webhook-id"
+	HeaderTimestamp = "webhook-timestamp"
+	HeaderSignature = "webhook-signature"
+
+	// Prefix of every secret generated by webhookd.
+	SecretPrefix = "whsec_"
+	// Version tag of HMAC-SHA256 signatures.
+	Version = "v1"
+
+	// Must be between 24 and 64 bytes according to the reference.
+	MinSecretSize = 24
+	MaxSecretSize = 64
+)
+
+var (
+	ErrInvalidSecret = errors.New("invalid secret")
+)
+
+// Decodes a whsec_ prefixed secret into its raw key.
+func ParseSecret(secret string) ([]byte, error) {
+	encoded, found := strings.CutPrefix(secret, SecretPrefix)
+	if !found {
+		return nil, fmt.Errorf("%w: missing %q prefix", ErrInvalidSecret, SecretPrefix)
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSecret, err)
+	}
+	if len(key) < MinSecretSize || len(key) > MaxSecretSize {
+		return nil, fmt.Errorf(
+			"%w: must have between %d and %d bytes",
+			ErrInvalidSecret, MinSecretSize, MaxSecretSize,
+		)
+	}
+	return key, nil
+}
+
+// Computes the "v1,<base64>" signature of the "id.timestamp.body" content.
+func Compute(key []byte, id string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+	mac.Write([]byte{'.'})
+	mac.Write([]byte(FormatTimestamp(timestamp)))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return Version + "," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Formats timestamp as the unix seconds expected in the webhook-timestamp header.
+func FormatTimestamp(timestamp time.Time) string {
+	return strconv.FormatInt(timestamp.Unix(), 10)
+}
+
+// Parses the unix seconds of a webhook-timestamp header.
+func ParseTimestamp(value string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
@@ -0,0 +1,86 @@
+package signature
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCompute(t *testing.T) {
+	// Reference values from the Standard Webhooks test suite.
+	key, err := ParseSecret("whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := "msg_p5jXN8AQM9LWM0D4loKWxJek"
+	timestamp := time.Unix(1614265330, 0)
+	body := []byte(`{"test": 2432232314}`)
+	expected := "v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE="
+
+	got := Compute(key, id, timestamp, body)
+	if got != expected {
+		t.Fatalf("expected signature %q but got %q", expected, got)
+	}
+}
+
+func TestParseSecret(t *testing.T) {
+	testCases := []struct {
+		name    string
+		secret  string
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			secret: "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw",
+		},
+		{
+			name:    "missing prefix",
+			secret:  "MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw",
+			wantErr: true,
+		},
+		{
+			name:    "invalid base64",
+			secret:  "whsec_not-base64!",
+			wantErr: true,
+		},
+		{
+			name:    "too short",
+			secret:  "whsec_Zm9vYmFy",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			secret:  "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSecret(tt.secret)
+			if tt.wantErr && !errors.Is(err, ErrInvalidSecret) {
+				t.Fatalf("expected ErrInvalidSecret but got %v", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("expected secret to be valid but got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	timestamp := time.Unix(1614265330, 0)
+
+	got, err := ParseTimestamp(FormatTimestamp(timestamp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(timestamp) {
+		t.Fatalf("expected %v but got %v", timestamp, got)
+	}
+
+	_, err = ParseTimestamp("foo")
+	if err == nil {
+		t.Fatal("expected invalid timestamp to fail")
+	}
+}
@@ -0,0 +1,150 @@
+// Package verify authenticates webhooks sent by webhookd.
+//
+// Receivers create a Verifier with the endpoint secret and either call
+// Verify with the raw request body or wrap their handler with Middleware.
+package verify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ffss92/webhookd/webhook/signature"
+)
+
+const (
+	// Default accepted distance between the webhook-timestamp header and the
+	// current time.
+	DefaultTolerance = 5 * time.Minute
+	// Default maximum request body read by Middleware.
+	DefaultMaxBodySize = 1 << 20
+)
+
+var (
+	ErrMissingHeaders      = errors.New("missing webhook headers")
+	ErrInvalidTimestamp    = errors.New("invalid webhook timestamp")
+	ErrTimestampTooOld     = errors.New("webhook timestamp too old")
+	ErrTimestampTooNew     = errors.New("webhook timestamp too new")
+	ErrNoMatchingSignature = errors.New("no matching signature found")
+)
+
+type Verifier struct {
+	// Accepted distance between the webhook timestamp and now. Defaults to
+	// DefaultTolerance when zero.
+	Tolerance time.Duration
+	// Maximum body size read by Middleware. Defaults to DefaultMaxBodySize
+	// when zero.
+	MaxBodySize int64
+
+	keys [][]byte
+	now  func() time.Time
+}
+
+// Creates a verifier that accepts signatures made with any of the given
+// whsec_ secrets.
+func New(secrets ...string) (*Verifier, error) {
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("%w: at least one secret is required", signature.ErrInvalidSecret)
+	}
+
+	keys := make([][]byte, 0, len(secrets))
+	for _, secret := range secrets {
+		key, err := signature.ParseSecret(secret)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return &Verifier{
+		keys: keys,
+		now:  time.Now,
+	}, nil
+}
+
+// Verifies the webhook headers against the raw request body.
+func (v *Verifier) Verify(header http.Header, body []byte) error {
+	id := header.Get(signature.HeaderID)
+	timestampHeader := header.Get(signature.HeaderTimestamp)
+	signatureHeader := header.Get(signature.HeaderSignature)
+	if id == "" || timestampHeader == "" || signatureHeader == "" {
+		return ErrMissingHeaders
+	}
+
+	timestamp, err := signature.ParseTimestamp(timestampHeader)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	if err := v.checkTimestamp(timestamp); err != nil {
+		return err
+	}
+
+	expected := make([][]byte, 0, len(v.keys))
+	for _, key := range v.keys {
+		expected = append(expected, []byte(signature.Compute(key, id, timestamp, body)))
+	}
+
+	for _, candidate := range strings.Fields(signatureHeader) {
+		version, _, found := strings.Cut(candidate, ",")
+		if !found || version != signature.Version {
+			continue
+		}
+		for _, want := range expected {
+			if hmac.Equal([]byte(candidate), want) {
+				return nil
+			}
+		}
+	}
+	return ErrNoMatchingSignature
+}
+
+func (v *Verifier) checkTimestamp(timestamp time.Time) error {
+	tolerance := v.Tolerance
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+
+	now := v.now()
+	if timestamp.Before(now.Add(-tolerance)) {
+		return ErrTimestampTooOld
+	}
+	if timestamp.After(now.Add(tolerance)) {
+		return ErrTimestampTooNew
+	}
+	return nil
+}
+
+// Middleware rejects requests with a missing or invalid signature with
+// 401 Unauthorized. Verified requests reach next with their body intact.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		maxBodySize := v.MaxBodySize
+		if maxBodySize == 0 {
+			maxBodySize = DefaultMaxBodySize
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		if err := v.Verify(r.Header, body); err != nil {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
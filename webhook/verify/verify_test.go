@@ -0,0 +1,185 @@
+package verify
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ffss92/webhookd/internal/webhook"
+	"github.com/ffss92/webhookd/webhook/signature"
+)
+
+func signedHeader(t *testing.T, timestamp time.Time, body []byte, secrets ...string) http.Header {
+	t.Helper()
+
+	signer, err := webhook.NewSigner(secrets...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make(http.Header)
+	signer.SetHeaders(header, "msg_1", timestamp, body)
+	return header
+}
+
+func TestVerify(t *testing.T) {
+	secret := webhook.NewSecret()
+	other := webhook.NewSecret()
+	body := []byte(`{"type":"test.created"}`)
+	now := time.Now()
+
+	testCases := []struct {
+		name     string
+		header   http.Header
+		body     []byte
+		expected error
+	}{
+		{
+			name:   "valid",
+			header: signedHeader(t, now, body, secret),
+			body:   body,
+		},
+		{
+			name:   "valid with multiple signatures",
+			header: signedHeader(t, now, body, other, secret),
+			body:   body,
+		},
+		{
+			name:     "wrong secret",
+			header:   signedHeader(t, now, body, other),
+			body:     body,
+			expected: ErrNoMatchingSignature,
+		},
+		{
+			name:     "tampered body",
+			header:   signedHeader(t, now, body, secret),
+			body:     []byte(`{"type":"test.deleted"}`),
+			expected: ErrNoMatchingSignature,
+		},
+		{
+			name:     "too old",
+			header:   signedHeader(t, now.Add(-10*time.Minute), body, secret),
+			body:     body,
+			expected: ErrTimestampTooOld,
+		},
+		{
+			name:     "too new",
+			header:   signedHeader(t, now.Add(10*time.Minute), body, secret),
+			body:     body,
+			expected: ErrTimestampTooNew,
+		},
+		{
+			name:     "missing headers",
+			header:   make(http.Header),
+			body:     body,
+			expected: ErrMissingHeaders,
+		},
+		{
+			name: "invalid timestamp",
+			header: http.Header{
+				"Webhook-Id":        {"msg_1"},
+				"Webhook-Timestamp": {"foo"},
+				"Webhook-Signature": {"v1,foo"},
+			},
+			body:     body,
+			expected: ErrInvalidTimestamp,
+		},
+	}
+
+	verifier, err := New(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifier.Verify(tt.header, tt.body)
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("expected error %v but got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestVerify_UnknownVersion(t *testing.T) {
+	secret := webhook.NewSecret()
+	body := []byte(`{}`)
+
+	header := signedHeader(t, time.Now(), body, secret)
+	header.Set(signature.HeaderSignature, "v2,"+strings.TrimPrefix(header.Get(signature.HeaderSignature), "v1,"))
+
+	verifier, err := New(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(header, body); !errors.Is(err, ErrNoMatchingSignature) {
+		t.Fatalf("expected ErrNoMatchingSignature but got %v", err)
+	}
+}
+
+func TestNew_InvalidSecret(t *testing.T) {
+	_, err := New("foo")
+	if !errors.Is(err, signature.ErrInvalidSecret) {
+		t.Fatalf("expected ErrInvalidSecret but got %v", err)
+	}
+
+	_, err = New()
+	if !errors.Is(err, signature.ErrInvalidSecret) {
+		t.Fatalf("expected ErrInvalidSecret but got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	secret := webhook.NewSecret()
+	body := `{"type":"test.created"}`
+
+	verifier, err := New(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != body {
+			t.Errorf("expected body to be preserved but got %q", b)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	testCases := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{
+			name:   "valid",
+			header: signedHeader(t, time.Now(), []byte(body), secret),
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "invalid",
+			header: signedHeader(t, time.Now(), []byte(body), webhook.NewSecret()),
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			req.Header = tt.header
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("expected status %d but got %d", tt.status, rec.Code)
+			}
+		})
+	}
+}